@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveModTime is the timestamp of every entry, so the same files
+// always produce the same zip (1980-01-01 is the minimum for zip)
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Archive writes a zip file streaming the content of the added files,
+// used both for web bundles and for multi file actions
+type Archive struct {
+	// FollowSymlinks archives the target of symbolic links,
+	// otherwise a symbolic link is an error
+	FollowSymlinks bool
+
+	logger *Logger
+	out    *os.File
+	w      *zip.Writer
+	count  int
+}
+
+// NewArchive creates the output file; the archive must be closed to complete it
+func NewArchive(outputFile string, followSymlinks bool, logger *Logger) (*Archive, error) {
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	logger.StartSpinner(fmt.Sprintf("Creating archive %s", outputFile))
+	return &Archive{
+		FollowSymlinks: followSymlinks,
+		logger:         logger,
+		out:            out,
+		w:              zip.NewWriter(out),
+	}, nil
+}
+
+// AddFile streams the file into the archive, keeping the executable bit
+func (a *Archive) AddFile(filename, zipName string) error {
+	info, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if !a.FollowSymlinks {
+			return fmt.Errorf("'%s' is a symbolic link: use --follow-symlinks to archive its target", filename)
+		}
+		info, err = os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("cannot follow symbolic link '%s': %w", filename, err)
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("'%s' is not a regular file", filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := a.create(zipName, archiveMode(info.Mode()))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("cannot archive '%s': %w", filename, err)
+	}
+	if Debugging {
+		a.logger.Debugf("added %s as %s", filename, zipName)
+	}
+	return nil
+}
+
+// AddContent adds generated content to the archive
+func (a *Archive) AddContent(content []byte, zipName string) error {
+	w, err := a.create(zipName, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (a *Archive) create(zipName string, mode fs.FileMode) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:     zipName,
+		Method:   zip.Deflate,
+		Modified: archiveModTime,
+	}
+	header.SetMode(mode)
+	a.count++
+	return a.w.CreateHeader(header)
+}
+
+// Close completes the archive, returning the first error
+func (a *Archive) Close() error {
+	err := a.w.Close()
+	if cerr := a.out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		a.logger.EndSpinnerMsg(true, fmt.Sprintf("Archived %d files in %s", a.count, a.out.Name()))
+	} else {
+		a.logger.EndSpinner(false)
+	}
+	return err
+}
+
+// Abort closes and removes an incomplete archive, after an error
+func (a *Archive) Abort() {
+	a.w.Close()
+	a.out.Close()
+	os.Remove(a.out.Name())
+	a.logger.EndSpinner(false)
+}
+
+// archiveMode keeps only the executable bit, so the archive
+// does not depend on the umask of who created it
+func archiveMode(mode fs.FileMode) fs.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// AddFiles streams the files, relative to baseFolder, stopping at the first error
+func (a *Archive) AddFiles(baseFolder string, files []string) error {
+	for _, file := range files {
+		if err := a.AddFile(filepath.Join(baseFolder, filepath.FromSlash(file)), file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
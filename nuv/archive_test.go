@@ -0,0 +1,118 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_archive(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.py"), []byte("print('hello')"), 0600)
+	os.WriteFile(filepath.Join(dir, "exec"), []byte("#!/bin/sh"), 0700)
+	os.Symlink(filepath.Join(dir, "main.py"), filepath.Join(dir, "link.py"))
+	target := filepath.Join(t.TempDir(), "out.zip")
+
+	t.Run("should keep the executable bit and stream the content", func(t *testing.T) {
+		a, err := NewArchive(target, false, NewLogger())
+		assert.NoError(t, err)
+		assert.NoError(t, a.AddFiles(dir, []string{"exec", "main.py"}))
+		assert.NoError(t, a.Close())
+
+		r, err := zip.OpenReader(target)
+		assert.NoError(t, err)
+		defer r.Close()
+		assert.Equal(t, os.FileMode(0755), r.File[0].Mode())
+		assert.Equal(t, os.FileMode(0644), r.File[1].Mode())
+		f, _ := r.File[1].Open()
+		content, _ := io.ReadAll(f)
+		assert.Equal(t, "print('hello')", string(content))
+	})
+
+	t.Run("should reject symbolic links unless following them", func(t *testing.T) {
+		a, _ := NewArchive(target, false, NewLogger())
+		err := a.AddFiles(dir, []string{"link.py"})
+		assert.ErrorContains(t, err, "is a symbolic link")
+		a.Abort()
+		assert.False(t, fileExists(target))
+
+		a, _ = NewArchive(target, true, NewLogger())
+		assert.NoError(t, a.AddFiles(dir, []string{"link.py"}))
+		assert.NoError(t, a.Close())
+		assert.Equal(t, []string{"link.py"}, zipEntries(t, target))
+	})
+
+	t.Run("should return the first error", func(t *testing.T) {
+		a, _ := NewArchive(target, false, NewLogger())
+		err := a.AddFiles(dir, []string{"main.py", "missing.py", "exec"})
+		assert.ErrorContains(t, err, "missing.py")
+		a.Abort()
+	})
+}
+
+func Test_packAction(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "__main__.py"), []byte("def main(args): pass"), 0644)
+	os.WriteFile(filepath.Join(dir, "mfa.zip"), []byte("previous pack"), 0644)
+	target := filepath.Join(dir, "mfa.zip")
+
+	assert.NoError(t, packAction(dir, target, nil, false, NewLogger()))
+	assert.Equal(t, []string{"__main__.py"}, zipEntries(t, target))
+
+	assert.Error(t, packAction(filepath.Join(dir, "missing"), target, nil, false, NewLogger()))
+}
+
+func Test_packActionKeepsIgnoredFiles(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{
+		"index.js":                   "require('left-pad')",
+		"index.js.map":               "{}",
+		".gitignore":                 "node_modules\n",
+		"nuvolaris.json":             "{}",
+		"node_modules/left-pad/x.js": "",
+		".git/HEAD":                  "ref: refs/heads/main",
+		"test/index.test.js":         "",
+	})
+	target := filepath.Join(t.TempDir(), "action.zip")
+
+	assert.NoError(t, packAction(dir, target, []string{"test/"}, false, NewLogger()))
+	assert.Equal(t, []string{".gitignore", "index.js", "index.js.map", "node_modules/left-pad/x.js", "nuvolaris.json"}, zipEntries(t, target))
+}
+
+func Test_packActionFollowsLinkedFolders(t *testing.T) {
+	dir := t.TempDir()
+	shared := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.js"), []byte("require('./lib/util')"), 0644)
+	os.WriteFile(filepath.Join(shared, "util.js"), []byte("module.exports = {}"), 0644)
+	os.Symlink(shared, filepath.Join(dir, "lib"))
+	target := filepath.Join(t.TempDir(), "action.zip")
+
+	assert.ErrorContains(t, packAction(dir, target, nil, false, NewLogger()), "'"+filepath.Join(dir, "lib")+"' is a symbolic link")
+
+	assert.NoError(t, packAction(dir, target, nil, true, NewLogger()))
+	assert.Equal(t, []string{"index.js", "lib/util.js"}, zipEntries(t, target))
+
+	// a link to a parent folder would never end
+	os.Symlink(dir, filepath.Join(shared, "loop"))
+	assert.ErrorContains(t, packAction(dir, target, nil, true, NewLogger()), "symbolic link 'lib/loop' points to one of its parent folders")
+}
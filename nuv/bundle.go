@@ -18,13 +18,18 @@
 package main
 
 import (
-	"archive/zip"
 	_ "embed"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
 //go:embed embed-bundle/index.js
@@ -33,13 +38,71 @@ var idx []byte
 //go:embed embed-bundle/package.json
 var pkg []byte
 
+const BundleConfigFile = "nuvolaris.json"
+
 type BundleCmd struct {
-	Path   string `arg:"" help:"Path containing the web application bundle to assemble." type:"path"`
-	Target string `arg:"" optional:"" help:"Name of of the output bundle" type:"path"`
+	Create bundleCreate `cmd:"" default:"withargs" help:"creates a web application bundle"`
+	Serve  bundleServe  `cmd:"" help:"serves a web application folder or bundle locally, as the web action does"`
+}
+
+type bundleCreate struct {
+	Path     string   `arg:"" help:"Path containing the web application bundle to assemble." type:"path"`
+	Target   string   `arg:"" optional:"" help:"Name of of the output bundle" type:"path"`
+	Include  []string `help:"glob patterns of the files to include (default: all files)"`
+	Exclude  []string `help:"glob patterns of the files to exclude, in .gitignore syntax"`
+	NoIgnore bool     `help:"do not honor .gitignore and .nuvignore files"`
+	Deploy   string   `help:"publish the bundle as a web action with the given name (<package>/<action>)"`
+
+	MaxAssetSize string `help:"offload to S3 the assets bigger than this size (e.g. 512KB)"`
+	MaxSize      string `help:"offload to S3 the biggest assets until the bundle fits this size (e.g. 32MB)"`
+	Bucket       string `help:"S3 bucket receiving the offloaded assets"`
+	PublicURL    string `name:"public-url" help:"url where the browsers reach the bucket, e.g. https://s3.example.com/assets (default: publicUrl of nuvolaris.json)"`
+	Precompress  bool   `help:"add gzip variants of the compressible binary assets, like wasm and fonts"`
+
+	FollowSymlinks bool `help:"archive the target of symbolic links instead of failing"`
+}
+
+// BundleConfig describes how to build a bundle, read from nuvolaris.json
+type BundleConfig struct {
+	Collect string `json:"collect"`
+	Install string `json:"install"`
+	Build   string `json:"build"`
+
+	// routing of the served bundle, see bundle_routes.go
+	Redirects []BundleRoute   `json:"redirects,omitempty"`
+	Rewrites  []BundleRoute   `json:"rewrites,omitempty"`
+	Headers   []BundleHeaders `json:"headers,omitempty"`
+	NotFound  string          `json:"notFound,omitempty"`
+
+	// PublicURL is where the browsers reach the bucket of the offloaded assets
+	PublicURL string `json:"publicUrl,omitempty"`
+}
+
+// runBundleCommand executes a build step in the bundle folder
+var runBundleCommand = func(dir, command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 
-func (s *BundleCmd) Run() error {
-	err := validateBundleStructure(s.Path)
+func (s *bundleCreate) Run(logger *Logger) error {
+	if !dirExists(s.Path) {
+		return fmt.Errorf("folder '%s' not found! Bundle requires an existing folder containing a valid web application source code", s.Path)
+	}
+
+	config, err := readBundleConfig(s.Path)
+	if err != nil {
+		return err
+	}
+
+	collectPath, err := buildBundle(s.Path, config)
+	if err != nil {
+		return err
+	}
+
+	err = validateBundleStructure(collectPath)
 	if err != nil {
 		return err
 	}
@@ -49,16 +112,160 @@ func (s *BundleCmd) Run() error {
 		return err
 	}
 
-	fmt.Printf("Creatin zipfile %s scanning folder '%s'\n", targetFile, s.Path)
-	err = ZipWriter(s.Path, targetFile)
-	return err
+	filter, err := newFileFilter(s.Include, s.Exclude, !s.NoIgnore)
+	if err != nil {
+		return err
+	}
+
+	publicURL := s.PublicURL
+	if publicURL == "" {
+		publicURL = config.PublicURL
+	}
+	budget, err := parseOffloadBudget(s.MaxAssetSize, s.MaxSize, s.Bucket, publicURL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Creatin zipfile %s scanning folder '%s'\n", targetFile, collectPath)
+	files, err := collectFiles(os.DirFS(collectPath), filter, s.FollowSymlinks)
+	if err != nil {
+		return err
+	}
+
+	routes, err := compileBundleRoutes(config, files)
+	if err != nil {
+		return fmt.Errorf("%s is not valid: %w", BundleConfigFile, err)
+	}
+	generated := map[string][]byte{}
+	if routes != nil {
+		generated[RoutesFile], err = json.MarshalIndent(routes, "", "  ")
+		if err != nil {
+			return err
+		}
+	}
+	if budget.maxSize > 0 {
+		// the manifest and the variants of all the files bound the ones of the files kept
+		budget.overhead, err = bundleOverhead(collectPath, files, generated, s.Precompress)
+		if err != nil {
+			return err
+		}
+	}
+	offloads, err := selectOffloads(collectPath, files, budget, servedFiles(config))
+	if err != nil {
+		return err
+	}
+	if len(offloads) > 0 {
+		prefix := strings.TrimSuffix(filepath.Base(targetFile), ".zip")
+		redirects := map[string]string{}
+		err = runS3(func(svc s3iface.S3API, bucket string) error {
+			redirects, err = offloadAssets(svc, bucket, prefix, budget.publicURL, collectPath, offloads)
+			return err
+		}, s.Bucket)
+		if err != nil {
+			return err
+		}
+		generated[RedirectsFile], err = json.MarshalIndent(redirects, "", "  ")
+		if err != nil {
+			return err
+		}
+		files = removeFiles(files, offloads)
+	}
+
+	manifest, variants, err := buildManifest(collectPath, files, s.Precompress)
+	if err != nil {
+		return err
+	}
+	for name, content := range variants {
+		generated[name] = content
+	}
+	generated[ManifestFile], err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = checkBundleSize(collectPath, files, generated, budget.maxSize); err != nil {
+		return err
+	}
+
+	err = ZipWriter(collectPath, targetFile, files, generated, s.FollowSymlinks, logger)
+	if err != nil || s.Deploy == "" {
+		return err
+	}
+	return deployBundle(Wsk, s.Deploy, targetFile)
 }
 
-func validateBundleStructure(basePath string) error {
-	if !dirExists(basePath) {
-		return fmt.Errorf("folder '%s' not found! Bundle requires an existing folder containing a valid web application source code", basePath)
+// readBundleConfig reads nuvolaris.json over the defaults described in DESIGN.md,
+// that depend on the presence of a package.json
+func readBundleConfig(basePath string) (BundleConfig, error) {
+	config := BundleConfig{Collect: "."}
+	if fileExists(filepath.Join(basePath, "package.json")) {
+		config = BundleConfig{
+			Collect: "public",
+			Install: "npm install",
+			Build:   "npm run build",
+		}
 	}
 
+	content, err := os.ReadFile(filepath.Join(basePath, BundleConfigFile))
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("%s is not valid: %w", BundleConfigFile, err)
+	}
+	return config, nil
+}
+
+// buildBundle runs install (only without node_modules) and build,
+// skipping the empty ones, and returns the folder to collect
+func buildBundle(basePath string, config BundleConfig) (string, error) {
+	if config.Install != "" && !dirExists(filepath.Join(basePath, "node_modules")) {
+		fmt.Printf("Installing: %s\n", config.Install)
+		if err := runBundleCommand(basePath, config.Install); err != nil {
+			return "", fmt.Errorf("install failed: %w", err)
+		}
+	}
+	if config.Build != "" {
+		fmt.Printf("Building: %s\n", config.Build)
+		if err := runBundleCommand(basePath, config.Build); err != nil {
+			return "", fmt.Errorf("build failed: %w", err)
+		}
+	}
+
+	if config.Collect == "" || config.Collect == "." {
+		return basePath, nil
+	}
+	collectPath := filepath.Join(basePath, config.Collect)
+	if !dirExists(collectPath) {
+		return "", fmt.Errorf("folder '%s' to collect not found after the build", collectPath)
+	}
+	return collectPath, nil
+}
+
+// deployBundle creates or updates the web action serving the bundle
+// and shows its url, as nuv url does
+func deployBundle(wsk func([]string, ...string) error, action, zipFile string) error {
+	parts := strings.Split(action, "/")
+	if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+		return fmt.Errorf("action name '%s' is not valid! Please use <package>/<action> or <action>.", action)
+	}
+
+	if len(parts) == 2 {
+		if err := wsk([]string{"wsk", "package"}, "update", parts[0]); err != nil {
+			return err
+		}
+	}
+	err := wsk([]string{"wsk", "action"}, "update", action, zipFile, "--kind", "nodejs:default", "--web", "true")
+	if err != nil {
+		return err
+	}
+	return wsk([]string{"wsk", "action", "get", "--url"}, action)
+}
+
+func validateBundleStructure(basePath string) error {
 	fileToCheck := filepath.Join(basePath, "index.html")
 	if !fileExists(fileToCheck) {
 		return fmt.Errorf("folder '%s' does not contain an index.html file. Bundle structure not valid.", basePath)
@@ -69,6 +276,11 @@ func validateBundleStructure(basePath string) error {
 		return fmt.Errorf("folder '%s' contains an index.js file. Bundle structure not valid.", basePath)
 	}
 
+	fileToCheck = filepath.Join(basePath, BundleDataFolder)
+	if dirExists(fileToCheck) {
+		return fmt.Errorf("folder '%s' contains a %s folder. Bundle structure not valid.", basePath, BundleDataFolder)
+	}
+
 	fileToCheck = filepath.Join(basePath, "package.json")
 	if fileExists(fileToCheck) {
 		return fmt.Errorf("folder '%s' contains a package.json file. Bundle structure not valid.", basePath)
@@ -92,90 +304,116 @@ func getTargetOutput(basePath, target string) (string, error) {
 	return target, nil
 }
 
-// Zip the content cretaing the output file
-func ZipWriter(baseFolder, outputFile string) error {
-
-	// Get a Buffer to Write To
-	outFile, err := os.Create(outputFile)
+// Zip the files of the folder and the generated content creating the output file
+func ZipWriter(baseFolder, outputFile string, files []string, generated map[string][]byte, followSymlinks bool, logger *Logger) error {
+	a, err := NewArchive(outputFile, followSymlinks, logger)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-	defer outFile.Close()
-
-	// Create a new zip archive.
-	w := zip.NewWriter(outFile)
-
-	// Add folder file to the archive.
-	addFiles(w, baseFolder, "")
-	// Add files to expose the bundle as OpwnWhisk actions
-	addContent(w, idx, "", "index.js")
-	addContent(w, pkg, "", "package.json")
-
-	if err != nil {
-		fmt.Println(err)
+	if err := writeBundle(a, baseFolder, files, generated); err != nil {
+		a.Abort()
 		return err
 	}
+	return a.Close()
+}
 
-	// Make sure to check the error on Close.
-	err = w.Close()
+// bundleOverhead is the size of the index.js, package.json and generated files,
+// with the manifest and the variants of all the files
+func bundleOverhead(baseFolder string, files []string, generated map[string][]byte, precompress bool) (int64, error) {
+	manifest, variants, err := buildManifest(baseFolder, files, precompress)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return 0, err
 	}
-
-	return nil
-}
-
-// Add Files recursively to the Output Folder
-func addFiles(w *zip.Writer, basePath, baseInZip string) {
-	// Open the Directory
-	files, err := ioutil.ReadDir(basePath)
+	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		fmt.Println(err)
+		return 0, err
 	}
-
-	for _, file := range files {
-		filename := filepath.Join(basePath, file.Name())
-		if !file.IsDir() {
-			addFile(w, baseInZip, filename, file.Name())
-		} else if file.IsDir() {
-			fmt.Printf("Processing folder %s \n", filename)
-			// Recurse
-			newBase := filepath.Join(basePath, file.Name(), "/")
-			addFiles(w, newBase, baseInZip+file.Name()+"/")
-		}
+	overhead := int64(len(idx) + len(pkg) + len(data))
+	for _, content := range generated {
+		overhead += int64(len(content))
+	}
+	for _, content := range variants {
+		overhead += int64(len(content))
 	}
+	return overhead, nil
 }
 
-// Add a single file to the Output folder
-func addFile(w *zip.Writer, baseInZip, filename, zipName string) {
-	dat, err := ioutil.ReadFile(filename)
-	if err != nil {
-		fmt.Println(err)
+func writeBundle(a *Archive, baseFolder string, files []string, generated map[string][]byte) error {
+	if err := a.AddFiles(baseFolder, files); err != nil {
+		return err
 	}
-	// Add some files to the archive.
-	f, err := w.Create(baseInZip + zipName)
-	if err != nil {
-		fmt.Println(err)
+	names := make([]string, 0, len(generated))
+	for name := range generated {
+		names = append(names, name)
 	}
-	_, err = f.Write(dat)
-	if err != nil {
-		fmt.Println(err)
+	sort.Strings(names)
+	for _, name := range names {
+		if err := a.AddContent(generated[name], name); err != nil {
+			return err
+		}
 	}
-	fmt.Printf("Added file %s \n", filename)
+	// Add files to expose the bundle as OpwnWhisk actions
+	if err := a.AddContent(idx, "index.js"); err != nil {
+		return err
+	}
+	return a.AddContent(pkg, "package.json")
 }
 
-// Add a single file to the Output folder
-func addContent(w *zip.Writer, content []byte, baseInZip, zipName string) {
-	// Add the content to the archive.
-	f, err := w.Create(baseInZip + zipName)
+// collectFiles lists the files to add to the bundle, sorted by path;
+// following symlinks it walks also into the linked folders
+func collectFiles(fsys fs.FS, filter *fileFilter, followSymlinks bool) ([]string, error) {
+	root, err := fs.Stat(fsys, ".")
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	files := []string{}
+	err = walkFiles(fsys, ".", filter, followSymlinks, []fs.FileInfo{root}, &files)
+	sort.Strings(files)
+	return files, err
+}
+
+// walkFiles adds the files of dir, refusing the links to one of the
+// parent folders that would make the walk endless
+func walkFiles(fsys fs.FS, dir string, filter *fileFilter, followSymlinks bool, parents []fs.FileInfo, files *[]string) error {
+	if err := filter.readIgnoreFiles(fsys, dir); err != nil {
+		return err
 	}
-	_, err = f.Write(content)
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
-	fmt.Printf("Added file %s \n", zipName)
+	for _, d := range entries {
+		name := path.Join(dir, d.Name())
+		var info fs.FileInfo
+		isDir := d.IsDir()
+		if followSymlinks && d.Type()&fs.ModeSymlink != 0 {
+			// a broken link is left to the archive to report
+			if info, err = fs.Stat(fsys, name); err == nil && info.IsDir() {
+				isDir = true
+			}
+		}
+		if !isDir {
+			if !filter.excluded(name, false) && filter.included(name) {
+				*files = append(*files, name)
+			}
+			continue
+		}
+		if filter.excluded(name, true) {
+			continue
+		}
+		if info == nil {
+			if info, err = d.Info(); err != nil {
+				return err
+			}
+		}
+		for _, parent := range parents {
+			if os.SameFile(parent, info) {
+				return fmt.Errorf("symbolic link '%s' points to one of its parent folders", name)
+			}
+		}
+		if err := walkFiles(fsys, name, filter, followSymlinks, append(parents, info), files); err != nil {
+			return err
+		}
+	}
+	return nil
 }
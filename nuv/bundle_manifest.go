@@ -0,0 +1,226 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFile describes how the bundle action serves each file
+const ManifestFile = BundleDataFolder + "/manifest.json"
+
+// precompressMinSize is the smallest file worth a gzip variant
+const precompressMinSize = 1024
+
+// compressibleTypes are the binary types worth a gzip variant: web actions
+// decode a base64 body only for binary types, so text cannot be sent encoded
+var compressibleTypes = map[string]bool{
+	"application/wasm":              true,
+	"application/vnd.ms-fontobject": true,
+	"font/ttf":                      true,
+	"font/otf":                      true,
+	"image/bmp":                     true,
+	"image/vnd.microsoft.icon":      true,
+}
+
+// contentTypes is fixed instead of using the system mime database,
+// so the same input always gives the same manifest
+var contentTypes = map[string]string{
+	".html":        "text/html; charset=utf-8",
+	".htm":         "text/html; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".webmanifest": "application/manifest+json",
+	".txt":         "text/plain; charset=utf-8",
+	".md":          "text/markdown; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".xml":         "application/xml",
+	".svg":         "image/svg+xml",
+	".png":         "image/png",
+	".jpg":         "image/jpeg",
+	".jpeg":        "image/jpeg",
+	".gif":         "image/gif",
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".bmp":         "image/bmp",
+	".ico":         "image/vnd.microsoft.icon",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".eot":         "application/vnd.ms-fontobject",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".ogg":         "audio/ogg",
+	".mp3":         "audio/mpeg",
+	".wav":         "audio/wav",
+	".pdf":         "application/pdf",
+	".wasm":        "application/wasm",
+	".zip":         "application/zip",
+	".gz":          "application/gzip",
+	".br":          "application/octet-stream",
+}
+
+type manifestEntry struct {
+	Type   string `json:"type"`
+	Hash   string `json:"hash"`
+	Binary bool   `json:"binary"`
+	Cache  string `json:"cache"`
+	Gzip   string `json:"gzip,omitempty"`
+	Brotli string `json:"br,omitempty"`
+}
+
+// buildManifest describes every file of the bundle; with precompress it also
+// returns the gzip variants of the compressible files to add to the bundle.
+// Only binary files have variants, the ones of text files are served as files
+func buildManifest(baseFolder string, files []string, precompress bool) (map[string]manifestEntry, map[string][]byte, error) {
+	manifest := map[string]manifestEntry{}
+	variants := map[string][]byte{}
+	existing := map[string]bool{}
+	for _, file := range files {
+		existing[file] = true
+	}
+
+	for _, file := range files {
+		entry, size, err := describeFile(filepath.Join(baseFolder, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, nil, err
+		}
+		// variants produced by the build are used as they are
+		if entry.Binary && existing[file+".br"] {
+			entry.Brotli = "/" + file + ".br"
+		}
+		if entry.Binary && existing[file+".gz"] {
+			entry.Gzip = "/" + file + ".gz"
+		} else if precompress && compressibleTypes[entry.Type] && size >= precompressMinSize {
+			content, err := gzipFile(filepath.Join(baseFolder, filepath.FromSlash(file)))
+			if err != nil {
+				return nil, nil, err
+			}
+			variants[file+".gz"] = content
+			entry.Gzip = "/" + file + ".gz"
+		}
+		manifest["/"+file] = entry
+	}
+	return manifest, variants, nil
+}
+
+func describeFile(filename string) (manifestEntry, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return manifestEntry{}, 0, err
+	}
+	defer f.Close()
+	return describeContent(filename, f)
+}
+
+// contentTypeOf uses the extension, sniffing the head of the content when it is unknown
+func contentTypeOf(name string, head []byte) string {
+	if ctype, ok := contentTypes[strings.ToLower(path.Ext(name))]; ok {
+		return ctype
+	}
+	return http.DetectContentType(head)
+}
+
+func describeContent(name string, f io.Reader) (manifestEntry, int64, error) {
+	// sniff the content when the extension is unknown
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return manifestEntry{}, 0, err
+	}
+	head = head[:n]
+	ctype := contentTypeOf(name, head)
+
+	hash := sha256.New()
+	hash.Write(head)
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return manifestEntry{}, 0, err
+	}
+
+	entry := manifestEntry{
+		Type:   ctype,
+		Hash:   hex.EncodeToString(hash.Sum(nil)),
+		Binary: !isTextType(ctype),
+		Cache:  "no-cache",
+	}
+	// a new deployment changes the name of a hashed file, so it never goes stale;
+	// the others are revalidated with their etag to pick up new deployments
+	if contentHashed(name) && !strings.HasPrefix(ctype, "text/html") {
+		entry.Cache = "public, max-age=31536000, immutable"
+	}
+	return entry, size + int64(n), nil
+}
+
+// contentHashed tells if the name carries the content hash bundlers add
+// before the extension, as in main.3f2a9c1b.js, index-B4x9qTz1.css
+// or 2.8e2f0c1d.chunk.js; a hash has digits, unlike words as main-component.js
+func contentHashed(name string) bool {
+	parts := strings.FieldsFunc(path.Base(filepath.ToSlash(name)), func(r rune) bool { return r == '.' || r == '-' })
+	if len(parts) < 3 {
+		return false
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		if len(part) >= 8 && strings.ContainsAny(part, "0123456789") {
+			return true
+		}
+	}
+	return false
+}
+
+func isTextType(ctype string) bool {
+	return strings.HasPrefix(ctype, "text/") ||
+		strings.Contains(ctype, "javascript") ||
+		strings.Contains(ctype, "json") ||
+		strings.Contains(ctype, "xml")
+}
+
+func gzipFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	// no name and timestamp in the header, to keep the output stable
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
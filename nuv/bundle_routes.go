@@ -0,0 +1,230 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RoutesFile holds the routing rules of nuvolaris.json, read by the bundle action
+const RoutesFile = "_nuvolaris/routes.json"
+
+// BundleRoute maps the paths matching Source (a glob where * matches
+// inside a path segment and ** across segments) to Destination
+type BundleRoute struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Status of a redirect, 302 by default
+	Status int `json:"status,omitempty"`
+}
+
+// BundleHeaders adds the headers to the responses for the paths matching Source
+type BundleHeaders struct {
+	Source  string            `json:"source"`
+	Headers map[string]string `json:"headers"`
+}
+
+// bundleRoutes is the validated routing of a bundle, with the sources
+// compiled to regular expressions understood both by Go and javascript
+type bundleRoutes struct {
+	Redirects []compiledRoute   `json:"redirects,omitempty"`
+	Rewrites  []compiledRoute   `json:"rewrites,omitempty"`
+	Headers   []compiledHeaders `json:"headers,omitempty"`
+	NotFound  string            `json:"notFound,omitempty"`
+}
+
+type compiledRoute struct {
+	BundleRoute
+	Regexp string `json:"regexp"`
+	re     *regexp.Regexp
+}
+
+type compiledHeaders struct {
+	BundleHeaders
+	Regexp string `json:"regexp"`
+	re     *regexp.Regexp
+}
+
+var redirectStatus = map[int]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+var headerName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// compileBundleRoutes validates the routing of the config against
+// the files of the bundle, returning nil when there are no rules
+func compileBundleRoutes(config BundleConfig, files []string) (*bundleRoutes, error) {
+	if len(config.Redirects) == 0 && len(config.Rewrites) == 0 && len(config.Headers) == 0 && config.NotFound == "" {
+		return nil, nil
+	}
+	exists := map[string]bool{}
+	for _, file := range files {
+		exists["/"+file] = true
+	}
+
+	routes := &bundleRoutes{NotFound: config.NotFound}
+	for i, r := range config.Redirects {
+		if r.Status == 0 {
+			r.Status = http.StatusFound
+		}
+		if !redirectStatus[r.Status] {
+			return nil, fmt.Errorf("redirects[%d]: status %d is not a redirect", i, r.Status)
+		}
+		if r.Destination == "" {
+			return nil, fmt.Errorf("redirects[%d]: missing destination", i)
+		}
+		route, err := compileRoute(r)
+		if err != nil {
+			return nil, fmt.Errorf("redirects[%d]: %w", i, err)
+		}
+		routes.Redirects = append(routes.Redirects, route)
+	}
+	for i, r := range config.Rewrites {
+		if r.Status != 0 {
+			return nil, fmt.Errorf("rewrites[%d]: a rewrite has no status", i)
+		}
+		if !exists[r.Destination] {
+			return nil, fmt.Errorf("rewrites[%d]: destination '%s' is not a file of the bundle", i, r.Destination)
+		}
+		route, err := compileRoute(r)
+		if err != nil {
+			return nil, fmt.Errorf("rewrites[%d]: %w", i, err)
+		}
+		routes.Rewrites = append(routes.Rewrites, route)
+	}
+	for i, h := range config.Headers {
+		re, err := compileRouteSource(h.Source)
+		if err != nil {
+			return nil, fmt.Errorf("headers[%d]: %w", i, err)
+		}
+		for name := range h.Headers {
+			if !headerName.MatchString(name) {
+				return nil, fmt.Errorf("headers[%d]: '%s' is not a valid header name", i, name)
+			}
+		}
+		routes.Headers = append(routes.Headers, compiledHeaders{h, re.String(), re})
+	}
+	if config.NotFound != "" && !exists[config.NotFound] {
+		return nil, fmt.Errorf("notFound: '%s' is not a file of the bundle", config.NotFound)
+	}
+	return routes, nil
+}
+
+// servedFiles are the files the action reads to answer, the notFound page
+// and the destinations of the rewrites, that cannot be offloaded
+func servedFiles(config BundleConfig) []string {
+	files := []string{}
+	if config.NotFound != "" {
+		files = append(files, config.NotFound)
+	}
+	for _, r := range config.Rewrites {
+		files = append(files, r.Destination)
+	}
+	return files
+}
+
+func compileRoute(r BundleRoute) (compiledRoute, error) {
+	re, err := compileRouteSource(r.Source)
+	if err != nil {
+		return compiledRoute{}, err
+	}
+	return compiledRoute{r, re.String(), re}, nil
+}
+
+// compileRouteSource turns a source glob into an anchored regexp
+func compileRouteSource(source string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(source, "/") {
+		return nil, fmt.Errorf("source '%s' must start with /", source)
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(source); i++ {
+		switch {
+		case strings.HasPrefix(source[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case source[i] == '*':
+			sb.WriteString("[^/]*")
+		default:
+			sb.WriteString(regexp.QuoteMeta(source[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// compile prepares the regexps of routes read from the bundle
+func (r *bundleRoutes) compile() error {
+	for i := range r.Redirects {
+		if err := r.Redirects[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range r.Rewrites {
+		if err := r.Rewrites[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range r.Headers {
+		re, err := regexp.Compile(r.Headers[i].Regexp)
+		if err != nil {
+			return err
+		}
+		r.Headers[i].re = re
+	}
+	return nil
+}
+
+func (c *compiledRoute) compile() error {
+	re, err := regexp.Compile(c.Regexp)
+	c.re = re
+	return err
+}
+
+func (r *bundleRoutes) redirect(path string) (BundleRoute, bool) {
+	for _, route := range r.Redirects {
+		if route.re.MatchString(path) {
+			return route.BundleRoute, true
+		}
+	}
+	return BundleRoute{}, false
+}
+
+func (r *bundleRoutes) rewrite(path string) (string, bool) {
+	for _, route := range r.Rewrites {
+		if route.re.MatchString(path) {
+			return route.Destination, true
+		}
+	}
+	return "", false
+}
+
+// headers collects the headers of all the rules matching the path,
+// the later rules overriding the earlier ones
+func (r *bundleRoutes) headers(path string) map[string]string {
+	res := map[string]string{}
+	for _, h := range r.Headers {
+		if h.re.MatchString(path) {
+			for k, v := range h.Headers {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,195 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/units"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// BundleDataFolder holds the files generated by nuv for the bundle action
+const BundleDataFolder = "_nuvolaris"
+
+// RedirectsFile maps the offloaded paths to their object urls
+const RedirectsFile = BundleDataFolder + "/redirects.json"
+
+type offloadBudget struct {
+	maxAssetSize int64
+	maxSize      int64
+	// publicURL is where the browsers reach the bucket
+	publicURL string
+	// overhead is the size of the files nuv adds to the bundle
+	overhead int64
+}
+
+func parseOffloadBudget(maxAssetSize, maxSize, bucket, publicURL string) (offloadBudget, error) {
+	budget := offloadBudget{}
+	if maxAssetSize == "" && maxSize == "" {
+		return budget, nil
+	}
+	if bucket == "" {
+		return budget, fmt.Errorf("please specify the --bucket where to offload the assets")
+	}
+	if publicURL == "" {
+		return budget, fmt.Errorf("please specify the --public-url of the bucket (or publicUrl in %s), where the browsers download the offloaded assets", BundleConfigFile)
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return budget, fmt.Errorf("invalid --public-url '%s': please use an http or https url", publicURL)
+	}
+	budget.publicURL = strings.TrimSuffix(publicURL, "/")
+	if maxAssetSize != "" {
+		if budget.maxAssetSize, err = units.ParseStrictBytes(maxAssetSize); err != nil {
+			return budget, fmt.Errorf("invalid --max-asset-size: %w", err)
+		}
+	}
+	if maxSize != "" {
+		if budget.maxSize, err = units.ParseStrictBytes(maxSize); err != nil {
+			return budget, fmt.Errorf("invalid --max-size: %w", err)
+		}
+	}
+	return budget, nil
+}
+
+// selectOffloads returns the assets over the size threshold, then the biggest
+// ones until the remaining files and the overhead fit in the bundle size;
+// the kept files, served by the action itself, stay in the bundle
+func selectOffloads(baseFolder string, files []string, budget offloadBudget, keep []string) ([]string, error) {
+	if budget.maxAssetSize == 0 && budget.maxSize == 0 {
+		return nil, nil
+	}
+	sizes := map[string]int64{}
+	total := budget.overhead
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(baseFolder, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+		sizes[file] = info.Size()
+		total += info.Size()
+	}
+
+	kept := map[string]bool{"index.html": true}
+	for _, file := range keep {
+		kept[strings.TrimPrefix(file, "/")] = true
+	}
+
+	bySize := append([]string{}, files...)
+	sort.SliceStable(bySize, func(i, j int) bool { return sizes[bySize[i]] > sizes[bySize[j]] })
+
+	offloads := []string{}
+	for _, file := range bySize {
+		overAsset := budget.maxAssetSize > 0 && sizes[file] > budget.maxAssetSize
+		overTotal := budget.maxSize > 0 && total > budget.maxSize
+		if kept[file] || !(overAsset || overTotal) {
+			continue
+		}
+		offloads = append(offloads, file)
+		total -= sizes[file]
+	}
+	if budget.maxSize > 0 && total > budget.maxSize {
+		return nil, fmt.Errorf("bundle cannot fit in %d bytes even offloading all the assets", budget.maxSize)
+	}
+	sort.Strings(offloads)
+	return offloads, nil
+}
+
+// offloadAssets uploads the files to the bucket and returns the redirects
+// from their paths in the bundle to the public object urls
+func offloadAssets(svc s3iface.S3API, bucket, prefix, publicURL, baseFolder string, files []string) (map[string]string, error) {
+	redirects := map[string]string{}
+	for _, file := range files {
+		key := prefix + "/" + file
+		if err := offloadAsset(svc, bucket, key, filepath.Join(baseFolder, filepath.FromSlash(file))); err != nil {
+			return nil, err
+		}
+		redirects["/"+file] = publicURL + "/" + escapeKey(key)
+	}
+	return redirects, nil
+}
+
+// offloadAsset streams the file to the bucket, as the assets
+// offloaded are the biggest ones of the bundle
+func offloadAsset(svc s3iface.S3API, bucket, key, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctype, err := sniffContentType(fileName, f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Offloading %q to bucket %q\n", key, bucket)
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Body:        f,
+		Key:         aws.String(key),
+		Bucket:      aws.String(bucket),
+		ACL:         aws.String(s3.BucketCannedACLPublicRead),
+		ContentType: aws.String(ctype),
+	})
+	if err != nil {
+		return s3Error(err, bucket, key)
+	}
+	return nil
+}
+
+// checkBundleSize verifies the bundle with its generated files fits in maxSize
+func checkBundleSize(baseFolder string, files []string, generated map[string][]byte, maxSize int64) error {
+	if maxSize == 0 {
+		return nil
+	}
+	total := int64(len(idx) + len(pkg))
+	for _, content := range generated {
+		total += int64(len(content))
+	}
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(baseFolder, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+	}
+	if total > maxSize {
+		return fmt.Errorf("bundle takes %d bytes, more than the %d of --max-size", total, maxSize)
+	}
+	return nil
+}
+
+func removeFiles(files, toRemove []string) []string {
+	removed := map[string]bool{}
+	for _, file := range toRemove {
+		removed[file] = true
+	}
+	res := []string{}
+	for _, file := range files {
+		if !removed[file] {
+			res = append(res, file)
+		}
+	}
+	return res
+}
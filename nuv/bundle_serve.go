@@ -0,0 +1,281 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type bundleServe struct {
+	Source    string `arg:"" help:"Folder or zip of the web application bundle to serve." type:"path"`
+	Port      int    `default:"8080" help:"port to listen on"`
+	Namespace string `default:"nuvolaris" help:"namespace of the web action in the served urls"`
+	Action    string `default:"default/bundle" help:"name of the web action in the served urls (<package>/<action>)"`
+}
+
+func (s *bundleServe) Run() error {
+	fsys, err := openBundleSource(s.Source)
+	if err != nil {
+		return err
+	}
+	server, err := newBundleServer(fsys, s.Namespace, s.Action)
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", s.Port)
+	fmt.Printf("Serving '%s' on http://%s%s\n", s.Source, addr, server.base)
+	return http.ListenAndServe(addr, server)
+}
+
+// openBundleSource accepts both the source folder and the zip created by nuv bundle
+func openBundleSource(source string) (fs.FS, error) {
+	if dirExists(source) {
+		return os.DirFS(source), nil
+	}
+	if fileExists(source) && strings.HasSuffix(source, ".zip") {
+		return zip.OpenReader(source)
+	}
+	return nil, fmt.Errorf("'%s' is not a folder or a zip file", source)
+}
+
+// bundleServer answers like the bundle action deployed with --web true
+type bundleServer struct {
+	fsys      fs.FS
+	base      string
+	manifest  map[string]manifestEntry
+	redirects map[string]string
+	routes    *bundleRoutes
+}
+
+func newBundleServer(fsys fs.FS, namespace, action string) (*bundleServer, error) {
+	// same as __OW_ACTION_NAME in replaceBase, adding the default package
+	parts := []string{namespace}
+	if !strings.Contains(action, "/") {
+		parts = append(parts, "default")
+	}
+	parts = append(parts, action)
+	server := &bundleServer{
+		fsys:      fsys,
+		base:      "/api/v1/web/" + strings.Join(parts, "/") + "/",
+		manifest:  map[string]manifestEntry{},
+		redirects: map[string]string{},
+		routes:    &bundleRoutes{},
+	}
+	if err := readBundleJSON(fsys, ManifestFile, &server.manifest); err != nil {
+		return nil, err
+	}
+	if err := readBundleJSON(fsys, RedirectsFile, &server.redirects); err != nil {
+		return nil, err
+	}
+	if err := readBundleRoutes(fsys, server.routes); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// readBundleRoutes reads the routes of a bundle, or compiles
+// them from the nuvolaris.json of a source folder
+func readBundleRoutes(fsys fs.FS, routes *bundleRoutes) error {
+	if _, err := fs.Stat(fsys, RoutesFile); err == nil {
+		if err := readBundleJSON(fsys, RoutesFile, routes); err != nil {
+			return err
+		}
+		return routes.compile()
+	}
+	var config BundleConfig
+	if err := readBundleJSON(fsys, BundleConfigFile, &config); err != nil {
+		return err
+	}
+	filter, err := newFileFilter(nil, nil, true)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(fsys, filter, false)
+	if err != nil {
+		return err
+	}
+	compiled, err := compileBundleRoutes(config, files)
+	if err != nil {
+		return fmt.Errorf("%s is not valid: %w", BundleConfigFile, err)
+	}
+	if compiled != nil {
+		*routes = *compiled
+	}
+	return nil
+}
+
+func readBundleJSON(fsys fs.FS, name string, v any) error {
+	content, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%s is not valid: %w", name, err)
+	}
+	return nil
+}
+
+func (b *bundleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root := strings.TrimSuffix(b.base, "/")
+	if !strings.HasPrefix(r.URL.Path, root) {
+		http.Redirect(w, r, b.base, http.StatusFound)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, root)
+	// as the action does when invoked without a path
+	if path == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<script>location.href += "/"</script>`)
+		return
+	}
+	extra := b.routes.headers(path)
+	for k, v := range extra {
+		w.Header().Set(k, v)
+	}
+	if location, ok := b.redirects[path]; ok {
+		http.Redirect(w, r, location, http.StatusFound)
+		return
+	}
+	if route, ok := b.routes.redirect(path); ok {
+		http.Redirect(w, r, b.redirectLocation(route.Destination), route.Status)
+		return
+	}
+	status := http.StatusOK
+	if path == "/" {
+		path = "/index.html"
+	} else if !b.exists(path) {
+		if destination, ok := b.routes.rewrite(path); ok {
+			path = destination
+		} else if b.routes.NotFound != "" {
+			path = b.routes.NotFound
+			status = http.StatusNotFound
+		} else {
+			path = "/index.html"
+		}
+	}
+
+	entry, ok := b.manifest[path]
+	if !ok {
+		var err error
+		entry, err = b.describe(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", entry.Type)
+	w.Header().Set("Cache-Control", entry.Cache)
+	etag := `"` + entry.Hash + `"`
+	w.Header().Set("ETag", etag)
+	// the headers of the rules win over the defaults
+	for k, v := range extra {
+		w.Header().Set(k, v)
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, encoding := variantFor(entry, r.Header.Get("Accept-Encoding"))
+	if file != "" {
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Vary", "Accept-Encoding")
+		path = file
+	}
+	content, err := fs.ReadFile(b.fsys, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// binary content travels base64 encoded and is sent as it is,
+	// text is rewritten to point to the action url
+	if file == "" && !entry.Binary {
+		content = []byte(b.replaceBase(string(content)))
+	}
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+func (b *bundleServer) exists(path string) bool {
+	if _, ok := b.manifest[path]; ok {
+		return true
+	}
+	info, err := fs.Stat(b.fsys, strings.TrimPrefix(path, "/"))
+	return err == nil && !info.IsDir()
+}
+
+func (b *bundleServer) describe(path string) (manifestEntry, error) {
+	f, err := b.fsys.Open(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+	entry, _, err := describeContent(path, f)
+	return entry, err
+}
+
+var baseReference = regexp.MustCompile(`((?:src|href)=['"])/`)
+
+// replaceBase works as the function of the same name in embed-bundle/index.js
+func (b *bundleServer) replaceBase(body string) string {
+	return baseReference.ReplaceAllString(body, "${1}"+b.base)
+}
+
+// redirectLocation works as the function of the same name in embed-bundle/index.js
+func (b *bundleServer) redirectLocation(destination string) string {
+	if strings.HasPrefix(destination, "/") && !strings.HasPrefix(destination, "//") {
+		return b.base + strings.TrimPrefix(destination, "/")
+	}
+	return destination
+}
+
+// etagMatches works as the function of the same name in embed-bundle/index.js
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// variantFor works as the function variant in embed-bundle/index.js
+func variantFor(entry manifestEntry, acceptEncoding string) (string, string) {
+	if !entry.Binary {
+		return "", ""
+	}
+	if entry.Brotli != "" && strings.Contains(acceptEncoding, "br") {
+		return entry.Brotli, "br"
+	}
+	if entry.Gzip != "" && strings.Contains(acceptEncoding, "gzip") {
+		return entry.Gzip, "gzip"
+	}
+	return "", ""
+}
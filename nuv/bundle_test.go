@@ -6,7 +6,7 @@
 // "License"); you may not use this file except in compliance
 // with the License.  You may obtain a copy of the License at
 //
-//   http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing,
 // software distributed under the License is distributed on an
@@ -14,21 +14,39 @@
 // KIND, either express or implied.  See the License for the
 // specific language governing permissions and limitations
 // under the License.
-//
 package main
 
 import (
-	"github.com/stretchr/testify/assert"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func Test_bundleRun(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.zip")
-	bundleCmd := BundleCmd{Path: "./test-bundle/test0", Target: targetFile}
-	bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/test0", Target: targetFile}
+	bundleCmd.Run(NewLogger())
 
 	exists := fileExists(targetFile)
 	assert.True(t, exists)
@@ -39,39 +57,544 @@ func Test_bundleRun(t *testing.T) {
 func Test_bundleFolderDoesNotExist(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.zip")
-	bundleCmd := BundleCmd{Path: "./test-bundle/fake", Target: targetFile}
-	err := bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/fake", Target: targetFile}
+	err := bundleCmd.Run(NewLogger())
 	assert.ErrorContains(t, err, "folder './test-bundle/fake' not found!")
 }
 
 func Test_indexFileDoesNotExist(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.zip")
-	bundleCmd := BundleCmd{Path: "./test-bundle/test1", Target: targetFile}
-	err := bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/test1", Target: targetFile}
+	err := bundleCmd.Run(NewLogger())
 	assert.ErrorContains(t, err, "folder './test-bundle/test1' does not contain an index.html file")
 }
 
 func Test_indexJsFileExist(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.zip")
-	bundleCmd := BundleCmd{Path: "./test-bundle/test2", Target: targetFile}
-	err := bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/test2", Target: targetFile}
+	err := bundleCmd.Run(NewLogger())
 	assert.ErrorContains(t, err, "folder './test-bundle/test2' contains an index.js file. Bundle structure not valid.")
 }
 
 func Test_PackageJsonFileExist(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.zip")
-	bundleCmd := BundleCmd{Path: "./test-bundle/test3", Target: targetFile}
-	err := bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/test3", Target: targetFile}
+	err := bundleCmd.Run(NewLogger())
 	assert.ErrorContains(t, err, "folder './test-bundle/test3' contains a package.json file. Bundle structure not valid.")
 }
 
 func Test_NonValidBundleTarget(t *testing.T) {
 	hd, _ := GetHomeDir()
 	targetFile := filepath.Join(hd, "test-bundle-output.tar")
-	bundleCmd := BundleCmd{Path: "./test-bundle/test0", Target: targetFile}
-	err := bundleCmd.Run()
+	bundleCmd := bundleCreate{Path: "./test-bundle/test0", Target: targetFile}
+	err := bundleCmd.Run(NewLogger())
 	assert.ErrorContains(t, err, "target '"+targetFile+"' is not valid! Please use .zip extension.")
 }
+
+func writeTestBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func zipEntries(t *testing.T, zipFile string) []string {
+	t.Helper()
+	r, err := zip.OpenReader(zipFile)
+	assert.NoError(t, err)
+	defer r.Close()
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func Test_bundleFilters(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":          "<h1>hello</h1>",
+		"app.js":              "console.log(1)",
+		"app.js.map":          "{}",
+		".DS_Store":           "",
+		".git/config":         "",
+		".nuvignore":          "secret.txt\ndrafts/\n",
+		"secret.txt":          "secret",
+		"drafts/page.html":    "",
+		"assets/logo.png":     "png",
+		"assets/.gitignore":   "*.psd\n",
+		"assets/logo.psd":     "psd",
+		"assets/img/icon.png": "png",
+	})
+	targetFile := filepath.Join(t.TempDir(), "out.zip")
+
+	bundleCmd := bundleCreate{Path: dir, Target: targetFile}
+	assert.NoError(t, bundleCmd.Run(NewLogger()))
+	assert.Equal(t, []string{"app.js", "assets/img/icon.png", "assets/logo.png", "index.html", "_nuvolaris/manifest.json", "index.js", "package.json"}, zipEntries(t, targetFile))
+
+	bundleCmd = bundleCreate{Path: dir, Target: targetFile, Exclude: []string{"img/"}, NoIgnore: true}
+	assert.NoError(t, bundleCmd.Run(NewLogger()))
+	assert.Equal(t, []string{"app.js", "assets/logo.png", "assets/logo.psd", "drafts/page.html", "index.html", "secret.txt", "_nuvolaris/manifest.json", "index.js", "package.json"}, zipEntries(t, targetFile))
+
+	bundleCmd = bundleCreate{Path: dir, Target: targetFile, Include: []string{"*.html"}}
+	assert.NoError(t, bundleCmd.Run(NewLogger()))
+	assert.Equal(t, []string{"index.html", "_nuvolaris/manifest.json", "index.js", "package.json"}, zipEntries(t, targetFile))
+}
+
+func Test_bundleIsDeterministic(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":    "<h1>hello</h1>",
+		"css/style.css": "h1 {}",
+	})
+	first := filepath.Join(t.TempDir(), "first.zip")
+	second := filepath.Join(t.TempDir(), "second.zip")
+
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: first}).Run(NewLogger()))
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "index.html"), later, later))
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: second}).Run(NewLogger()))
+
+	a, _ := os.ReadFile(first)
+	b, _ := os.ReadFile(second)
+	assert.Equal(t, a, b)
+}
+
+func Example_deployBundle() {
+	wsk := func(cmd []string, args ...string) error {
+		fmt.Println(strings.Join(append(cmd, args...), " "))
+		return nil
+	}
+	deployBundle(wsk, "web/site", "site.zip")
+	deployBundle(wsk, "site", "site.zip")
+	fmt.Println(deployBundle(wsk, "a/b/c", "site.zip"))
+	// Output:
+	// wsk package update web
+	// wsk action update web/site site.zip --kind nodejs:default --web true
+	// wsk action get --url web/site
+	// wsk action update site site.zip --kind nodejs:default --web true
+	// wsk action get --url site
+	// action name 'a/b/c' is not valid! Please use <package>/<action> or <action>.
+}
+
+func Test_readBundleConfig(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{"index.html": ""})
+	config, err := readBundleConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, BundleConfig{Collect: "."}, config)
+
+	dir = writeTestBundle(t, map[string]string{"package.json": "{}"})
+	config, err = readBundleConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, BundleConfig{Collect: "public", Install: "npm install", Build: "npm run build"}, config)
+
+	dir = writeTestBundle(t, map[string]string{"package.json": "{}", "nuvolaris.json": `{"collect": "dist"}`})
+	config, err = readBundleConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, BundleConfig{Collect: "dist", Install: "npm install", Build: "npm run build"}, config)
+
+	dir = writeTestBundle(t, map[string]string{"nuvolaris.json": `{"collect":`})
+	_, err = readBundleConfig(dir)
+	assert.ErrorContains(t, err, "nuvolaris.json is not valid")
+}
+
+func Test_bundleBuildAndCollect(t *testing.T) {
+	realRun := runBundleCommand
+	defer func() { runBundleCommand = realRun }()
+	executed := []string{}
+	runBundleCommand = func(dir, command string) error {
+		executed = append(executed, command)
+		return os.WriteFile(filepath.Join(dir, "dist", "index.html"), []byte("built"), 0644)
+	}
+
+	dir := writeTestBundle(t, map[string]string{
+		"package.json":   "{}",
+		"nuvolaris.json": `{"collect": "dist"}`,
+		"src/main.js":    "",
+		"dist/.gitkeep":  "",
+	})
+	targetFile := filepath.Join(t.TempDir(), "out.zip")
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: targetFile}).Run(NewLogger()))
+	assert.Equal(t, []string{"npm install", "npm run build"}, executed)
+	assert.Equal(t, []string{".gitkeep", "index.html", "_nuvolaris/manifest.json", "index.js", "package.json"}, zipEntries(t, targetFile))
+
+	// install is skipped when node_modules is already there
+	executed = []string{}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "node_modules"), 0755))
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: targetFile}).Run(NewLogger()))
+	assert.Equal(t, []string{"npm run build"}, executed)
+
+	// a plain static folder runs nothing
+	executed = []string{}
+	dir = writeTestBundle(t, map[string]string{"index.html": ""})
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: targetFile}).Run(NewLogger()))
+	assert.Empty(t, executed)
+}
+
+func Test_selectOffloads(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":      strings.Repeat("h", 100),
+		"video.mp4":       strings.Repeat("v", 1000),
+		"font.woff2":      strings.Repeat("f", 300),
+		"assets/logo.png": strings.Repeat("l", 200),
+	})
+	files := []string{"assets/logo.png", "font.woff2", "index.html", "video.mp4"}
+
+	offloads, err := selectOffloads(dir, files, offloadBudget{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, offloads)
+
+	offloads, err = selectOffloads(dir, files, offloadBudget{maxAssetSize: 250}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"font.woff2", "video.mp4"}, offloads)
+
+	offloads, err = selectOffloads(dir, files, offloadBudget{maxSize: 500}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"font.woff2", "video.mp4"}, offloads)
+
+	// the pages served by the action are kept in the bundle
+	config := BundleConfig{NotFound: "/font.woff2", Rewrites: []BundleRoute{{Source: "/app/*", Destination: "/assets/logo.png"}}}
+	offloads, err = selectOffloads(dir, files, offloadBudget{maxAssetSize: 150}, servedFiles(config))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"video.mp4"}, offloads)
+
+	// the files generated by nuv take room in the bundle too
+	offloads, err = selectOffloads(dir, files, offloadBudget{maxSize: 500, overhead: 250}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"assets/logo.png", "font.woff2", "video.mp4"}, offloads)
+
+	_, err = selectOffloads(dir, files, offloadBudget{maxSize: 50}, nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, checkBundleSize(dir, []string{"index.html"}, nil, int64(100+len(idx)+len(pkg))))
+	assert.ErrorContains(t, checkBundleSize(dir, []string{"index.html"}, map[string][]byte{ManifestFile: []byte("{}")}, int64(100+len(idx)+len(pkg))), "more than the")
+}
+
+func Test_offloadAssets(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{"video.mp4": "video", "my clip#1?.mp4": "clip"})
+	mockSvc := new(mockS3Client)
+	mockSvc.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+
+	redirects, err := offloadAssets(mockSvc, "assets", "site", "https://cdn.example.com/assets", dir, []string{"video.mp4", "my clip#1?.mp4"})
+	assert.NoError(t, err)
+	mockSvc.AssertCalled(t, "PutObject", mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+		_, streamed := in.Body.(*os.File)
+		return *in.Bucket == "assets" && *in.Key == "site/video.mp4" && streamed
+	}))
+	assert.Equal(t, map[string]string{
+		"/video.mp4":      "https://cdn.example.com/assets/site/video.mp4",
+		"/my clip#1?.mp4": "https://cdn.example.com/assets/site/my%20clip%231%3F.mp4",
+	}, redirects)
+
+	_, err = parseOffloadBudget("1MB", "", "", "https://cdn.example.com")
+	assert.ErrorContains(t, err, "--bucket")
+	_, err = parseOffloadBudget("1MB", "", "assets", "")
+	assert.ErrorContains(t, err, "--public-url")
+	_, err = parseOffloadBudget("1MB", "", "assets", "minio.nuvolaris:9000")
+	assert.ErrorContains(t, err, "invalid --public-url")
+	budget, err := parseOffloadBudget("1KB", "2MB", "assets", "https://cdn.example.com/assets/")
+	assert.NoError(t, err)
+	assert.Equal(t, offloadBudget{maxAssetSize: 1000, maxSize: 2000000, publicURL: "https://cdn.example.com/assets"}, budget)
+}
+
+func Test_buildManifest(t *testing.T) {
+	css := strings.Repeat("h1 { color: red }\n", 100)
+	wasm := strings.Repeat("\x00asm", 300)
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":        "<h1>hello</h1>",
+		"css/style.css":     css,
+		"js/app.js":         "console.log(1)",
+		"js/app.js.br":      "brotli",
+		"img/logo.svg":      "<svg></svg>",
+		"img/photo.webp":    "RIFF",
+		"img/photo.webp.br": "brotli",
+		"data/unknown.blob": "\x00\x01\x02",
+		"app.wasm":          wasm,
+	})
+	files := []string{"app.wasm", "css/style.css", "data/unknown.blob", "img/logo.svg", "img/photo.webp", "img/photo.webp.br", "index.html", "js/app.js", "js/app.js.br"}
+
+	manifest, variants, err := buildManifest(dir, files, true)
+	assert.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(css))
+	assert.Equal(t, manifestEntry{
+		Type:  "text/css; charset=utf-8",
+		Hash:  hex.EncodeToString(sum[:]),
+		Cache: "no-cache",
+	}, manifest["/css/style.css"])
+	sum = sha256.Sum256([]byte(wasm))
+	assert.Equal(t, manifestEntry{
+		Type:   "application/wasm",
+		Hash:   hex.EncodeToString(sum[:]),
+		Binary: true,
+		Cache:  "no-cache",
+		Gzip:   "/app.wasm.gz",
+	}, manifest["/app.wasm"])
+	assert.Contains(t, variants, "app.wasm.gz")
+	assert.Len(t, variants, 1)
+
+	assert.Equal(t, "no-cache", manifest["/index.html"].Cache)
+	assert.Equal(t, "no-cache", manifest["/js/app.js"].Cache)
+	assert.False(t, manifest["/index.html"].Binary)
+	assert.Equal(t, "image/svg+xml", manifest["/img/logo.svg"].Type)
+	assert.False(t, manifest["/img/logo.svg"].Binary)
+	assert.Equal(t, "image/webp", manifest["/img/photo.webp"].Type)
+	assert.True(t, manifest["/img/photo.webp"].Binary)
+	assert.Equal(t, "application/octet-stream", manifest["/data/unknown.blob"].Type)
+	assert.Equal(t, "/img/photo.webp.br", manifest["/img/photo.webp"].Brotli)
+	// text is returned as a string by the action, so it has no variants
+	assert.Empty(t, manifest["/js/app.js"].Brotli)
+}
+
+// runBundleAction invokes the main of embed-bundle/index.js from the dir with node
+func runBundleAction(t *testing.T, dir string, path string, headers map[string]string) map[string]interface{} {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.js"), idx, 0644))
+	args, err := json.Marshal(map[string]interface{}{"__ow_path": path, "__ow_headers": headers})
+	assert.NoError(t, err)
+	cmd := exec.Command(node, "-e", "console.log(JSON.stringify(require(process.argv[1]).main(JSON.parse(process.argv[2]))))",
+		filepath.Join(dir, "index.js"), string(args))
+	cmd.Env = append(os.Environ(), "__OW_ACTION_NAME=/nuvolaris/bundle")
+	out, err := cmd.Output()
+	assert.NoError(t, err)
+	res := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out, &res))
+	return res
+}
+
+func Test_contentHashed(t *testing.T) {
+	for _, name := range []string{"js/main.3f2a9c1b.js", "assets/index-B4x9qTz1.css", "static/media/logo.5d5d9eef.svg", "static/js/2.8e2f0c1d.chunk.js"} {
+		assert.True(t, contentHashed(name), name)
+	}
+	for _, name := range []string{"app.js", "main-component.js", "jquery-3.6.0.min.js", "index.html", "font.woff2"} {
+		assert.False(t, contentHashed(name), name)
+	}
+	entry, _, err := describeContent("js/main.3f2a9c1b.js", strings.NewReader("x"))
+	assert.NoError(t, err)
+	assert.Equal(t, "public, max-age=31536000, immutable", entry.Cache)
+}
+
+func Test_bundleActionOutput(t *testing.T) {
+	css := strings.Repeat("h1 { color: red }\n", 100)
+	wasm := strings.Repeat("\x00asm", 300)
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":       "<h1>hello</h1>",
+		"css/style.css":    css,
+		"css/style.css.gz": "gzipped by the build",
+		"app.wasm":         wasm,
+		"_nuvolaris/.keep": "",
+	})
+	manifest, variants, err := buildManifest(dir, []string{"app.wasm", "css/style.css", "css/style.css.gz", "index.html"}, true)
+	assert.NoError(t, err)
+	for name, content := range variants {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0644))
+	}
+	content, _ := json.Marshal(manifest)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFile), content, 0644))
+	gzipped := map[string]string{"accept-encoding": "gzip, deflate, br"}
+
+	res := runBundleAction(t, dir, "/css/style.css", gzipped)
+	headers := res["headers"].(map[string]interface{})
+	assert.Nil(t, headers["Content-Encoding"])
+	assert.Equal(t, css, res["body"])
+
+	res = runBundleAction(t, dir, "/app.wasm", gzipped)
+	headers = res["headers"].(map[string]interface{})
+	assert.Equal(t, "gzip", headers["Content-Encoding"])
+	assert.Equal(t, "application/wasm", headers["Content-Type"])
+	body, err := base64.StdEncoding.DecodeString(res["body"].(string))
+	assert.NoError(t, err)
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	assert.NoError(t, err)
+	decoded, _ := io.ReadAll(r)
+	assert.Equal(t, wasm, string(decoded))
+
+	etag := headers["ETag"].(string)
+	res = runBundleAction(t, dir, "/app.wasm", map[string]string{"if-none-match": "W/" + etag})
+	assert.Equal(t, float64(304), res["statusCode"])
+	res = runBundleAction(t, dir, "/app.wasm", map[string]string{"if-none-match": `"other", ` + etag})
+	assert.Equal(t, float64(304), res["statusCode"])
+	res = runBundleAction(t, dir, "/app.wasm", map[string]string{"if-none-match": `"other"`})
+	assert.Equal(t, float64(200), res["statusCode"])
+}
+
+func Test_etagMatches(t *testing.T) {
+	assert.True(t, etagMatches(`"abc"`, `"abc"`))
+	assert.True(t, etagMatches(`W/"abc"`, `"abc"`))
+	assert.True(t, etagMatches(`"x", W/"abc"`, `"abc"`))
+	assert.True(t, etagMatches(`*`, `"abc"`))
+	assert.False(t, etagMatches(`"x"`, `"abc"`))
+	assert.False(t, etagMatches(``, `"abc"`))
+}
+
+func Test_bundleServe(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":                {Data: []byte(`<script src="/app.js"></script>`)},
+		"app.js":                    {Data: []byte(`console.log("hello")`)},
+		"logo.png":                  {Data: []byte("\x89PNG\r\n\x1a\n binary")},
+		"_nuvolaris/redirects.json": {Data: []byte(`{"/video.mp4": "http://s3/video.mp4"}`)},
+	}
+	server, err := newBundleServer(fsys, "nuvolaris", "bundle")
+	assert.Nil(t, err)
+	base := "/api/v1/web/nuvolaris/default/bundle"
+
+	get := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	res := get(base)
+	assert.Equal(t, `<script>location.href += "/"</script>`, res.Body.String())
+
+	res = get(base + "/")
+	assert.Equal(t, `<script src="`+base+`/app.js"></script>`, res.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header().Get("Cache-Control"))
+
+	res = get(base + "/missing/route")
+	assert.Equal(t, `<script src="`+base+`/app.js"></script>`, res.Body.String())
+
+	res = get(base + "/logo.png")
+	assert.Equal(t, "image/png", res.Header().Get("Content-Type"))
+	assert.Equal(t, "\x89PNG\r\n\x1a\n binary", res.Body.String())
+
+	res = get(base+"/app.js", "If-None-Match", res.Header().Get("ETag"))
+	assert.Equal(t, 200, res.Code)
+	res = get(base+"/app.js", "If-None-Match", res.Header().Get("ETag"))
+	assert.Equal(t, 304, res.Code)
+	res = get(base+"/app.js", "If-None-Match", `"other", W/`+res.Header().Get("ETag"))
+	assert.Equal(t, 304, res.Code)
+
+	res = get(base + "/video.mp4")
+	assert.Equal(t, 302, res.Code)
+	assert.Equal(t, "http://s3/video.mp4", res.Header().Get("Location"))
+
+	res = get("/")
+	assert.Equal(t, 302, res.Code)
+	assert.Equal(t, base+"/", res.Header().Get("Location"))
+}
+
+func Test_bundleCommands(t *testing.T) {
+	var cli struct {
+		Bundle BundleCmd `cmd:""`
+	}
+	parser, err := kong.New(&cli)
+	assert.Nil(t, err)
+	ctx, err := parser.Parse([]string{"bundle", "./test-bundle/test0"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bundle create <path>", ctx.Command())
+	ctx, err = parser.Parse([]string{"bundle", "serve", "./test-bundle/test0"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bundle serve <source>", ctx.Command())
+}
+
+func Test_compileBundleRoutes(t *testing.T) {
+	files := []string{"index.html", "404.html", "app/shell.html"}
+
+	routes, err := compileBundleRoutes(BundleConfig{}, files)
+	assert.NoError(t, err)
+	assert.Nil(t, routes)
+
+	routes, err = compileBundleRoutes(BundleConfig{
+		Redirects: []BundleRoute{{Source: "/old/**", Destination: "/"}},
+		Rewrites:  []BundleRoute{{Source: "/app/*", Destination: "/app/shell.html"}},
+		Headers:   []BundleHeaders{{Source: "/**", Headers: map[string]string{"Content-Security-Policy": "default-src 'self'"}}},
+		NotFound:  "/404.html",
+	}, files)
+	assert.NoError(t, err)
+	assert.Equal(t, 302, routes.Redirects[0].Status)
+	assert.Equal(t, "^/old/.*$", routes.Redirects[0].Regexp)
+	assert.Equal(t, "^/app/[^/]*$", routes.Rewrites[0].Regexp)
+	dest, ok := routes.rewrite("/app/settings")
+	assert.True(t, ok)
+	assert.Equal(t, "/app/shell.html", dest)
+	_, ok = routes.rewrite("/app/settings/profile")
+	assert.False(t, ok)
+
+	_, err = compileBundleRoutes(BundleConfig{Redirects: []BundleRoute{{Source: "/a", Destination: "/b", Status: 200}}}, files)
+	assert.ErrorContains(t, err, "status 200 is not a redirect")
+	_, err = compileBundleRoutes(BundleConfig{Rewrites: []BundleRoute{{Source: "/a", Destination: "/missing.html"}}}, files)
+	assert.ErrorContains(t, err, "is not a file of the bundle")
+	_, err = compileBundleRoutes(BundleConfig{Rewrites: []BundleRoute{{Source: "a", Destination: "/index.html"}}}, files)
+	assert.ErrorContains(t, err, "must start with /")
+	_, err = compileBundleRoutes(BundleConfig{Headers: []BundleHeaders{{Source: "/", Headers: map[string]string{"Bad Header": "x"}}}}, files)
+	assert.ErrorContains(t, err, "not a valid header name")
+	_, err = compileBundleRoutes(BundleConfig{NotFound: "/missing.html"}, files)
+	assert.ErrorContains(t, err, "notFound")
+}
+
+func Test_bundleServeRoutes(t *testing.T) {
+	dir := writeTestBundle(t, map[string]string{
+		"index.html":     "<h1>home</h1>",
+		"404.html":       "<h1>not found</h1>",
+		"app/shell.html": "<h1>app</h1>",
+		BundleConfigFile: `{
+			"redirects": [
+				{"source": "/old", "destination": "/new", "status": 301},
+				{"source": "/docs/**", "destination": "https://docs.example.com/", "status": 302}
+			],
+			"rewrites": [{"source": "/app/**", "destination": "/app/shell.html"}],
+			"headers": [{"source": "/**", "headers": {"Access-Control-Allow-Origin": "*", "Cache-Control": "no-store"}}],
+			"notFound": "/404.html"
+		}`,
+	})
+	targetFile := filepath.Join(t.TempDir(), "routes.zip")
+	assert.NoError(t, (&bundleCreate{Path: dir, Target: targetFile}).Run(NewLogger()))
+	assert.Contains(t, zipEntries(t, targetFile), RoutesFile)
+
+	fsys, err := openBundleSource(targetFile)
+	assert.NoError(t, err)
+	server, err := newBundleServer(fsys, "nuvolaris", "bundle")
+	assert.NoError(t, err)
+	base := "/api/v1/web/nuvolaris/default/bundle"
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", base+path, nil))
+		return rec
+	}
+
+	res := get("/old")
+	assert.Equal(t, 301, res.Code)
+	assert.Equal(t, base+"/new", res.Header().Get("Location"))
+	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "https://docs.example.com/", get("/docs/intro").Header().Get("Location"))
+
+	res = get("/app/users/1")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "<h1>app</h1>", res.Body.String())
+
+	res = get("/missing")
+	assert.Equal(t, 404, res.Code)
+	assert.Equal(t, "<h1>not found</h1>", res.Body.String())
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	// the action redirects under its own url too
+	routes, err := fs.ReadFile(fsys, RoutesFile)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, BundleDataFolder), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, RoutesFile), routes, 0644))
+	action := runBundleAction(t, dir, "/old", nil)
+	assert.Equal(t, float64(301), action["statusCode"])
+	assert.Equal(t, base+"/new", action["headers"].(map[string]interface{})["Location"])
+	action = runBundleAction(t, dir, "/docs/intro", nil)
+	assert.Equal(t, "https://docs.example.com/", action["headers"].(map[string]interface{})["Location"])
+
+	_, err = newBundleServer(fstest.MapFS{
+		"index.html":     {Data: []byte("")},
+		BundleConfigFile: {Data: []byte(`{"notFound": "/404.html"}`)},
+	}, "nuvolaris", "bundle")
+	assert.ErrorContains(t, err, "notFound")
+}
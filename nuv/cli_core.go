@@ -40,12 +40,14 @@ type CLI struct {
 	Logs   LogsCmd   `aliases:"l" cmd:"" passthrough:"" help:"show activation logs"`
 	Result ResultCmd `aliases:"r"  cmd:"" passthrough:"" help:"show activation results"`
 	Poll   PollCmd   `aliases:"po" cmd:"" help:"poll activations"`
-	Bundle BundleCmd `aliases:"bu" cmd:"" help:"creates a web application bundle"`
+	Bundle BundleCmd `aliases:"bu" cmd:"" help:"creates or serves a web application bundle"`
+	Deploy DeployCmd `aliases:"de" cmd:"" help:"deploy a project, optionally for an environment"`
+	Pack   PackCmd   `cmd:"" help:"zip the folder of a multi file action"`
 
 	// Setup
 	Setup      SetupCmd      `cmd:"" help:"setup nuvolaris"`
 	Auth       AuthCmd       `cmd:"" help:"configure authentication"`
-	Devcluster DevClusterCmd `cmd:"" help:"create or destroy kind k8s cluster"`
+	Devcluster DevClusterCmd `cmd:"" help:"create, destroy, stop, start or inspect the kind k8s cluster"`
 
 	// work in progress
 	Scan ScanCmd `cmd:"" help:"scan subcommand" hidden:""`
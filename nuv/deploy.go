@@ -0,0 +1,298 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"sigs.k8s.io/yaml"
+)
+
+const DeployConfigFile = "nuvolaris.yml"
+const DotenvFile = ".env"
+
+// DeployTaskfile is the taskfile generated in ~/.nuvolaris, named apart
+// from the nuvolaris.<env>.yml overlays of the project
+const DeployTaskfile = "deploy.taskfile.yml"
+
+type DeployCmd struct {
+	Path string `arg:"" optional:"" default:"./" help:"Path of the project to deploy." type:"path"`
+	Env  string `help:"environment profile to deploy (loads nuvolaris.<env>.yml, .env.<env> and .wskprops.<env>)"`
+}
+
+// DeployConfig holds the per project customizations read from nuvolaris.yml
+type DeployConfig struct {
+	Packages map[string]DeployPackage `json:"packages,omitempty"`
+}
+
+type DeployPackage struct {
+	Name   string            `json:"name,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+type deployTaskfile struct {
+	Version int                   `json:"version"`
+	Tasks   map[string]deployTask `json:"tasks"`
+}
+
+type deployTask struct {
+	Dir  string   `json:"dir"`
+	Cmds []string `json:"cmds"`
+}
+
+func (d *DeployCmd) Run() error {
+	if err := validateEnv(d.Env); err != nil {
+		return err
+	}
+	fsys := os.DirFS(d.Path)
+
+	vars, err := readDotenv(fsys, d.Env)
+	if err != nil {
+		return err
+	}
+
+	config, err := readDeployConfig(fsys, d.Env, vars)
+	if err != nil {
+		return err
+	}
+
+	err = selectWskProps(d.Env)
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(d.Path)
+	if err != nil {
+		return err
+	}
+	taskfile, err := generateDeployTaskfile(fsys, dir, config)
+	if err != nil {
+		return err
+	}
+
+	path, err := WriteFileToNuvolarisConfigDir(deployTaskfileName(d.Env), []byte(taskfile))
+	if err != nil {
+		return err
+	}
+
+	return Task("-t", path)
+}
+
+// validateEnv rejects the environment names that would move
+// the files they select outside of their folder
+func validateEnv(env string) error {
+	if strings.ContainsAny(env, `/\`) || strings.Contains(env, "..") {
+		return fmt.Errorf("invalid environment '%s': path separators and '..' are not allowed", env)
+	}
+	return nil
+}
+
+// envFilename inserts the environment name in a filename,
+// so nuvolaris.yml becomes nuvolaris.staging.yml and .env becomes .env.staging
+func envFilename(name, env string) string {
+	if env == "" {
+		return name
+	}
+	dir, base := filepath.Split(name)
+	ext := filepath.Ext(base)
+	// dotfiles like .env have no extension to preserve
+	if ext == base {
+		ext = ""
+	}
+	return dir + strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+// deployTaskfileName is deploy.taskfile.yml or deploy.<env>.taskfile.yml
+func deployTaskfileName(env string) string {
+	if env == "" {
+		return DeployTaskfile
+	}
+	return "deploy." + env + ".taskfile.yml"
+}
+
+// readDotenv loads .env, then overlays .env.<env> when it exists
+func readDotenv(fsys fs.FS, env string) (map[string]string, error) {
+	vars := map[string]string{}
+	files := []string{DotenvFile}
+	if env != "" {
+		files = append(files, envFilename(DotenvFile, env))
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		overlay, err := godotenv.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for k, v := range overlay {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+func readDeployConfig(fsys fs.FS, env string, vars map[string]string) (DeployConfig, error) {
+	config := DeployConfig{Packages: map[string]DeployPackage{}}
+	files := []string{DeployConfigFile}
+	if env != "" {
+		files = append(files, envFilename(DeployConfigFile, env))
+	}
+	for i, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the base config is optional, the overlay of a requested environment is not
+			if i == 0 {
+				continue
+			}
+			return DeployConfig{}, fmt.Errorf("environment config '%s' not found", file)
+		}
+		if err != nil {
+			return DeployConfig{}, err
+		}
+		var overlay DeployConfig
+		if err := yaml.Unmarshal(content, &overlay); err != nil {
+			return DeployConfig{}, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := interpolateConfig(&overlay, vars); err != nil {
+			return DeployConfig{}, fmt.Errorf("%s: %w", file, err)
+		}
+		mergeDeployConfig(&config, overlay)
+	}
+	return config, nil
+}
+
+// mergeDeployConfig applies the overlay on top of the config:
+// package names are replaced, parameters are merged key by key
+func mergeDeployConfig(config *DeployConfig, overlay DeployConfig) {
+	for name, pkg := range overlay.Packages {
+		current := config.Packages[name]
+		if pkg.Name != "" {
+			current.Name = pkg.Name
+		}
+		if len(pkg.Params) > 0 && current.Params == nil {
+			current.Params = map[string]string{}
+		}
+		for k, v := range pkg.Params {
+			current.Params[k] = v
+		}
+		config.Packages[name] = current
+	}
+}
+
+var varPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateConfig replaces the variables in the parsed values,
+// so their content never goes through the yaml parser
+func interpolateConfig(config *DeployConfig, vars map[string]string) error {
+	missing := []string{}
+	for name, pkg := range config.Packages {
+		pkg.Name = interpolateVars(pkg.Name, vars, &missing)
+		for k, v := range pkg.Params {
+			pkg.Params[k] = interpolateVars(v, vars, &missing)
+		}
+		config.Packages[name] = pkg
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("undefined variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// interpolateVars replaces ${VAR} with the values from the dotenv file,
+// falling back to the process environment, and collects the missing ones
+func interpolateVars(value string, vars map[string]string, missing *[]string) string {
+	return varPlaceholder.ReplaceAllStringFunc(value, func(m string) string {
+		name := varPlaceholder.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		*missing = append(*missing, name)
+		return m
+	})
+}
+
+// selectWskProps points wsk to the credentials of the environment
+func selectWskProps(env string) error {
+	if env == "" {
+		return setWskEnvVariable(true)
+	}
+	path, err := getWhiskPropsPath()
+	if err != nil {
+		return err
+	}
+	path = envFilename(path, env)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("%s file not found. Run nuv auth for the %s environment and save it there", path, env)
+	}
+	return os.Setenv("WSK_CONFIG_FILE", path)
+}
+
+// generateDeployTaskfile works like generateTaskfile, applying the config
+// and running the commands from the project folder
+func generateDeployTaskfile(fsys fs.FS, dir string, config DeployConfig) (string, error) {
+	b, err := packagesFolderExists(fsys)
+	if !b {
+		return "", fmt.Errorf("folder '%s' not found! Cannot deploy project :(", ScanFolder)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	projectTree, err := visitScanFolder(fsys)
+	if err != nil {
+		return "", err
+	}
+
+	for _, pkg := range projectTree.packages {
+		if custom, ok := config.Packages[pkg.name]; ok {
+			if custom.Name != "" {
+				pkg.name = custom.Name
+			}
+			pkg.params = custom.Params
+		}
+	}
+
+	taskfile, err := yaml.Marshal(deployTaskfile{
+		Version: 3,
+		Tasks: map[string]deployTask{
+			"default": {Dir: dir, Cmds: parseProjectTree(&projectTree)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(taskfile), nil
+}
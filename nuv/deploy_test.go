@@ -0,0 +1,121 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_envFilename(t *testing.T) {
+	assert.Equal(t, "nuvolaris.yml", envFilename("nuvolaris.yml", ""))
+	assert.Equal(t, "nuvolaris.staging.yml", envFilename("nuvolaris.yml", "staging"))
+	assert.Equal(t, ".env.staging", envFilename(".env", "staging"))
+	assert.Equal(t, "/home/user/.nuvolaris/.wskprops.prod", envFilename("/home/user/.nuvolaris/.wskprops", "prod"))
+}
+
+func Test_readDeployConfig(t *testing.T) {
+	project := fstest.MapFS{
+		"nuvolaris.yml": {Data: []byte(`
+packages:
+  billing:
+    params:
+      currency: EUR
+      db: ${DB_URL}
+`)},
+		"nuvolaris.staging.yml": {Data: []byte(`
+packages:
+  billing:
+    name: billing-staging
+    params:
+      db: ${DB_URL}/staging
+`)},
+		".env":         {Data: []byte("DB_URL=mongodb://local\nCURRENCY=EUR\n")},
+		".env.staging": {Data: []byte("DB_URL=mongodb://staging\n")},
+	}
+
+	t.Run("should merge the environment overlay on top of the base config", func(t *testing.T) {
+		vars, err := readDotenv(project, "staging")
+		assert.NoError(t, err)
+		config, err := readDeployConfig(project, "staging", vars)
+		assert.NoError(t, err)
+		assert.Equal(t, "billing-staging", config.Packages["billing"].Name)
+		assert.Equal(t, "EUR", config.Packages["billing"].Params["currency"])
+		assert.Equal(t, "mongodb://staging/staging", config.Packages["billing"].Params["db"])
+	})
+
+	t.Run("should return error when a variable is not defined", func(t *testing.T) {
+		_, err := readDeployConfig(project, "", map[string]string{})
+		assert.ErrorContains(t, err, "undefined variables: DB_URL")
+	})
+
+	t.Run("should load the base dotenv below the environment one", func(t *testing.T) {
+		vars, err := readDotenv(project, "staging")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"DB_URL": "mongodb://staging", "CURRENCY": "EUR"}, vars)
+		vars, err = readDotenv(project, "prod")
+		assert.NoError(t, err)
+		assert.Equal(t, "mongodb://local", vars["DB_URL"])
+	})
+
+	t.Run("should keep the yaml special characters of the values", func(t *testing.T) {
+		config, err := readDeployConfig(project, "", map[string]string{"DB_URL": "x: '#1\n- [y"})
+		assert.NoError(t, err)
+		assert.Equal(t, "x: '#1\n- [y", config.Packages["billing"].Params["db"])
+	})
+
+	t.Run("should return error when the environment does not exist", func(t *testing.T) {
+		_, err := readDeployConfig(project, "prod", map[string]string{"DB_URL": "x"})
+		assert.ErrorContains(t, err, "'nuvolaris.prod.yml' not found")
+	})
+}
+
+func Test_validateEnv(t *testing.T) {
+	assert.NoError(t, validateEnv(""))
+	assert.NoError(t, validateEnv("staging"))
+	for _, env := range []string{"../prod", "a/b", `a\b`, ".."} {
+		assert.ErrorContains(t, validateEnv(env), "invalid environment", env)
+	}
+}
+
+func Example_generateDeployTaskfile() {
+	project := fstest.MapFS{
+		ScanFolder + "/billing/form.js": {Data: []byte{}},
+	}
+	config := DeployConfig{Packages: map[string]DeployPackage{
+		"billing": {Name: "billing-prod", Params: map[string]string{"b": "it's", "a": "1"}},
+	}}
+	taskfile, _ := generateDeployTaskfile(project, "/project", config)
+	fmt.Println(taskfile)
+	// Output:
+	// tasks:
+	//   default:
+	//     cmds:
+	//     - nuv wsk package update billing-prod -p a '1' -p b 'it'\''s'
+	//     - nuv wsk action update billing-prod/form packages/billing/form.js --kind nodejs:default
+	//     dir: /project
+	// version: 3
+}
+
+func Test_deployTaskfileName(t *testing.T) {
+	assert.Equal(t, "deploy.taskfile.yml", deployTaskfileName(""))
+	assert.Equal(t, "deploy.staging.taskfile.yml", deployTaskfileName("staging"))
+}
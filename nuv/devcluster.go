@@ -17,8 +17,19 @@
 //
 package main
 
+import "os"
+
 type DevClusterCmd struct {
-	Action string `arg:"" required:"" enum:"create,destroy" help:"create/destroy" type:"string"`
+	Action        string      `arg:"" required:"" enum:"create,destroy,stop,start,status" help:"create/destroy/stop/start/status" type:"string"`
+	Output        string      `short:"o" default:"table" enum:"table,json" help:"status output format (table or json)"`
+	Workers       optionalInt `placeholder:"N" help:"number of worker nodes (default 1)"`
+	Image         string      `help:"kind node image" xor:"image"`
+	K8sVersion    string      `name:"k8s-version" help:"kubernetes version of the nodes, e.g. v1.24.0" xor:"image"`
+	APIServerPort int         `name:"api-server-port" help:"host port of the kubernetes api server"`
+	Port          map[int]int `help:"remap a host port, e.g. --port 80=8080"`
+	Mount         []string    `help:"extra mount of the nodes as <host path>:<container path>[:ro]"`
+	RemapPorts    bool        `name:"remap-ports" help:"remap the host ports already in use to free ones"`
+	Registry      bool        `help:"start a local registry on localhost:5001 wired into the cluster"`
 }
 
 func (devClusterCmd *DevClusterCmd) Run(logger *Logger) error {
@@ -26,5 +37,35 @@ func (devClusterCmd *DevClusterCmd) Run(logger *Logger) error {
 	if err != nil {
 		return err
 	}
+	if devClusterCmd.Action == "status" {
+		return config.printClusterStatus(os.Stdout, devClusterCmd.Output)
+	}
+	topology, err := devClusterCmd.topology()
+	if err != nil {
+		return err
+	}
+	config.topology = config.topology.merge(topology)
+	config.remapPorts = devClusterCmd.RemapPorts
 	return config.manageKindCluster(logger, devClusterCmd.Action)
 }
+
+func (devClusterCmd *DevClusterCmd) topology() (devClusterTopology, error) {
+	topology := devClusterTopology{
+		Image:             devClusterCmd.Image,
+		KubernetesVersion: devClusterCmd.K8sVersion,
+		APIServerPort:     devClusterCmd.APIServerPort,
+		Ports:             devClusterCmd.Port,
+		Registry:          devClusterCmd.Registry,
+	}
+	if devClusterCmd.Workers.set {
+		topology.Workers = &devClusterCmd.Workers.value
+	}
+	for _, m := range devClusterCmd.Mount {
+		mount, err := parseMount(m)
+		if err != nil {
+			return topology, err
+		}
+		topology.Mounts = append(topology.Mounts, mount)
+	}
+	return topology, nil
+}
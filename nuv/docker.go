@@ -31,3 +31,8 @@ func dockerInfo(dryRun bool) (string, error) {
 func dockerVersion(dryRun bool) (string, error) {
 	return sysErr(dryRun, "@docker version --format {{.Server.Version}}")
 }
+
+// dockerCommand runs docker with the given arguments and returns its output
+func dockerCommand(args ...string) (string, error) {
+	return sysErr(false, "@docker", args...)
+}
@@ -19,57 +19,136 @@
 
 const fs = require('fs');
 
-ctypes = {
-    "gif": "image/gif",
-    "jpg": "image/jpeg",
-    "png": "image/png",
-    "ico": "image/vnd.microsoft.icon",
-    "ttf": "font/ttf",
-    "woff": "font/woff",
-    "woff2": "font/woff2",
-    "svg": "image/svg"
+// assets offloaded to S3 by nuv bundle, answered with a redirect
+let redirects = {}
+if (fs.existsSync(`${__dirname}/_nuvolaris/redirects.json`)) {
+    redirects = JSON.parse(fs.readFileSync(`${__dirname}/_nuvolaris/redirects.json`))
 }
 
-function isBinary(file) {
-    return file.endsWith(".gif") ||
-        file.endsWith(".jpg") ||
-        file.endsWith(".png") ||
-        file.endsWith(".ico") ||
-        file.endsWith(".ttf") ||
-        file.endsWith(".woff") ||
-        file.endsWith(".woff2") ||
-        file.endsWith(".svg")        
+// files of the bundle with type, hash and variants, generated by nuv bundle
+let manifest = {}
+if (fs.existsSync(`${__dirname}/_nuvolaris/manifest.json`)) {
+    manifest = JSON.parse(fs.readFileSync(`${__dirname}/_nuvolaris/manifest.json`))
 }
 
-// replace base in html and css
-function replaceBase(path, body) {
-    // calculate toReplace    
+// routing rules of nuvolaris.json, validated by nuv bundle
+let routes = {}
+if (fs.existsSync(`${__dirname}/_nuvolaris/routes.json`)) {
+    routes = JSON.parse(fs.readFileSync(`${__dirname}/_nuvolaris/routes.json`))
+}
+for (let kind of ["redirects", "rewrites", "headers"]) {
+    routes[kind] = (routes[kind] || []).map(r => Object.assign(r, { re: new RegExp(r.regexp) }))
+}
+
+// headers of all the rules matching the path, the later ones win
+function routeHeaders(path) {
+    let res = {}
+    for (let rule of routes.headers) {
+        if (rule.re.test(path))
+            Object.assign(res, rule.headers)
+    }
+    return res
+}
+
+const defaultEntry = {
+    "type": "application/octet-stream",
+    "binary": true,
+    "cache": "no-cache"
+}
+
+// url of the web action, where the paths of the bundle are served
+function actionBase() {
     let a = process.env['__OW_ACTION_NAME'].split("/")
     if(a.length == 3) a.splice(-1, 0, "default")
-    let toReplace = "/api/v1/web"+ a.join("/")+"/";
+    return "/api/v1/web"+ a.join("/")+"/";
+}
+
+// replace base in html and css
+function replaceBase(path, body) {
+    let toReplace = actionBase()
     // replace all
     const toFind = /(?<=(src|href)=['"])\//g
     return body.replace(toFind, toReplace)
 }
 
-function body(path) {
-    let file = `${__dirname}${path}`
-    if (path=="/" || !fs.existsSync(file)) {
-        file = `${__dirname}/index.html`
+// paths of the bundle are moved under the action base, urls are left as they are
+function redirectLocation(destination) {
+    if (destination.startsWith("/") && !destination.startsWith("//"))
+        return actionBase() + destination.substring(1)
+    return destination
+}
+
+// choose a precompressed variant accepted by the client: only binary
+// content is base64 decoded by the platform, so text is never encoded
+function variant(entry, headers) {
+    if (!entry.binary)
+        return [null, null]
+    let accept = headers["accept-encoding"] || ""
+    if (entry.br && accept.includes("br"))
+        return [entry.br, "br"]
+    if (entry.gzip && accept.includes("gzip"))
+        return [entry.gzip, "gzip"]
+    return [null, null]
+}
+
+// the If-None-Match header is * or a list of etags, weak ones included
+function etagMatches(header, etag) {
+    if (!header)
+        return false
+    return header.split(",").some(tag => {
+        tag = tag.trim()
+        return tag == "*" || tag.replace(/^W\//, "") == etag
+    })
+}
+
+function exists(path) {
+    return path in manifest || fs.existsSync(`${__dirname}${path}`)
+}
+
+function body(path, headers) {
+    let statusCode = 200
+    if (path == "/") {
+        path = "/index.html"
+    } else if (!exists(path)) {
+        let rule = routes.rewrites.find(r => r.re.test(path))
+        if (rule) {
+            path = rule.destination
+        } else if (routes.notFound) {
+            path = routes.notFound
+            statusCode = 404
+        } else {
+            path = "/index.html"
+        }
     }
-    let data = fs.readFileSync(file)
-    if(isBinary(file)) 
-        return {
-            body: data.toString("base64"),
-            statusCode: 200,
-            headers: {
-                "Content-Type": ctypes[path.split(".").pop()]
-            }
+    let entry = manifest[path] || defaultEntry
+    let res = {
+        statusCode: statusCode,
+        headers: {
+            "Content-Type": entry.type,
+            "Cache-Control": entry.cache
+        }
+    }
+    if (entry.hash) {
+        let etag = `"${entry.hash}"`
+        res.headers["ETag"] = etag
+        if (etagMatches(headers["if-none-match"], etag)) {
+            res.statusCode = 304
+            return res
         }
-    return {
-        body: replaceBase(path, data.toString("utf-8")),
-        statusCode: 200,
     }
+    let [file, encoding] = variant(entry, headers)
+    if (file) {
+        res.headers["Content-Encoding"] = encoding
+        res.headers["Vary"] = "Accept-Encoding"
+        res.body = fs.readFileSync(`${__dirname}${file}`).toString("base64")
+        return res
+    }
+    let data = fs.readFileSync(`${__dirname}${path}`)
+    if (entry.binary)
+        res.body = data.toString("base64")
+    else
+        res.body = replaceBase(path, data.toString("utf-8"))
+    return res
 }
 
 function check(args) {
@@ -87,9 +166,31 @@ function main(args) {
         return { "body": res }
     }
     let path = args['__ow_path'];
+    let extra = routeHeaders(path)
+    // redirect offloaded assets
+    if (path in redirects) {
+        return {
+            statusCode: 302,
+            headers: Object.assign(extra, {
+                "Location": redirects[path]
+            })
+        }
+    }
+    // redirects of nuvolaris.json
+    let rule = routes.redirects.find(r => r.re.test(path))
+    if (rule) {
+        return {
+            statusCode: rule.status,
+            headers: Object.assign(extra, {
+                "Location": redirectLocation(rule.destination)
+            })
+        }
+    }
     // send body
     if (path != "") {
-        return body(path) 
+        let res = body(path, args['__ow_headers'] || {})
+        Object.assign(res.headers, extra)
+        return res
     }
     // return redirect if no path
     return { "body": `<script>location.href += "/"</script>` }
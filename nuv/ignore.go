@@ -0,0 +1,244 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFiles are read in every folder, with the .gitignore syntax
+var IgnoreFiles = []string{".gitignore", ".nuvignore"}
+
+// junkExcludes are the version control and system files, never worth publishing
+var junkExcludes = []string{".git/", ".svn/", ".hg/", ".DS_Store", "Thumbs.db"}
+
+// defaultExcludes are never useful in a deployed bundle
+var defaultExcludes = append(append([]string{}, junkExcludes...), "*.map", ".gitignore", ".nuvignore", "/"+BundleConfigFile)
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// fileFilter selects the files to archive using include patterns
+// and exclude rules in the .gitignore syntax: the last matching rule wins
+type fileFilter struct {
+	include     []ignoreRule
+	exclude     []ignoreRule
+	ignoreFiles []string
+}
+
+// newFileFilter is the filter of the bundles, excluding the defaultExcludes
+// and, when honoring them, the files listed in the IgnoreFiles
+func newFileFilter(include, exclude []string, honorIgnoreFiles bool) (*fileFilter, error) {
+	f, err := newPatternFilter(include, append(append([]string{}, defaultExcludes...), exclude...))
+	if err != nil {
+		return nil, err
+	}
+	if honorIgnoreFiles {
+		f.ignoreFiles = IgnoreFiles
+	}
+	return f, nil
+}
+
+// newPatternFilter selects the files using only the given patterns
+func newPatternFilter(include, exclude []string) (*fileFilter, error) {
+	f := &fileFilter{}
+	for _, pattern := range include {
+		rule, ok, err := compileIgnoreRule(pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			f.include = append(f.include, rule)
+		}
+	}
+	if err := f.addRules(exclude, ""); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// liftDefaults drops the default excludes an include pattern opts back in,
+// as --include .git/** does for .git/
+func liftDefaults(defaults, include []string) []string {
+	res := []string{}
+	for _, pattern := range defaults {
+		name := strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+		lifted := false
+		for _, inc := range include {
+			inc = strings.TrimPrefix(inc, "/")
+			if inc == name || strings.HasPrefix(inc, name+"/") {
+				lifted = true
+			}
+		}
+		if !lifted {
+			res = append(res, pattern)
+		}
+	}
+	return res
+}
+
+func (f *fileFilter) addRules(patterns []string, base string) error {
+	for _, pattern := range patterns {
+		rule, ok, err := compileIgnoreRule(pattern, base)
+		if err != nil {
+			return err
+		}
+		if ok {
+			f.exclude = append(f.exclude, rule)
+		}
+	}
+	return nil
+}
+
+// readIgnoreFiles loads the ignore files found in dir, relative to it
+func (f *fileFilter) readIgnoreFiles(fsys fs.FS, dir string) error {
+	for _, name := range f.ignoreFiles {
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		base := dir
+		if base == "." {
+			base = ""
+		}
+		if err := f.addRules(strings.Split(string(content), "\n"), base); err != nil {
+			return fmt.Errorf("%s: %w", path.Join(dir, name), err)
+		}
+	}
+	return nil
+}
+
+func (f *fileFilter) excluded(name string, isDir bool) bool {
+	res := false
+	for _, rule := range f.exclude {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(name) {
+			res = !rule.negate
+		}
+	}
+	return res
+}
+
+// selected tells if the filter keeps the file, checking also the
+// exclusion of its parent folders as the walk of the folders does
+func (f *fileFilter) selected(name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if f.excluded(dir, true) {
+			return false
+		}
+	}
+	return !f.excluded(name, false) && f.included(name)
+}
+
+// included tells if the file matches an include pattern, itself or
+// through one of its parent folders as the excluded folders do
+func (f *fileFilter) included(name string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, rule := range f.include {
+		if !rule.dirOnly && rule.re.MatchString(name) {
+			return true
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if rule.re.MatchString(dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compileIgnoreRule turns a .gitignore pattern into a regexp matching
+// slash separated paths; it returns false for blank lines and comments
+func compileIgnoreRule(pattern, base string) (ignoreRule, bool, error) {
+	rule := ignoreRule{}
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	// a pattern with a slash is relative to the folder of the ignore file
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if base != "" {
+		sb.WriteString(regexp.QuoteMeta(base) + "/")
+	}
+	if !anchored {
+		sb.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return rule, false, fmt.Errorf("invalid pattern '%s'", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return rule, false, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	rule.re = re
+	return rule, true, nil
+}
@@ -0,0 +1,88 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compileIgnoreRule(t *testing.T) {
+	matches := func(pattern, base, name string) bool {
+		rule, ok, err := compileIgnoreRule(pattern, base)
+		assert.True(t, ok)
+		assert.NoError(t, err)
+		return rule.re.MatchString(name)
+	}
+
+	assert.True(t, matches("*.map", "", "js/app.js.map"))
+	assert.False(t, matches("*.map", "", "js/app.js"))
+	assert.True(t, matches("/dist", "", "dist"))
+	assert.False(t, matches("/dist", "", "src/dist"))
+	assert.True(t, matches("docs/*.md", "", "docs/readme.md"))
+	assert.False(t, matches("docs/*.md", "", "docs/api/readme.md"))
+	assert.True(t, matches("docs/**/*.md", "", "docs/api/readme.md"))
+	assert.True(t, matches("**/tmp", "", "a/b/tmp"))
+	assert.True(t, matches("img?.png", "", "img1.png"))
+	assert.True(t, matches("[ab].txt", "", "b.txt"))
+	assert.True(t, matches("*.psd", "assets", "assets/x/logo.psd"))
+	assert.False(t, matches("*.psd", "assets", "logo.psd"))
+
+	_, ok, _ := compileIgnoreRule("# comment", "")
+	assert.False(t, ok)
+	_, ok, _ = compileIgnoreRule("   ", "")
+	assert.False(t, ok)
+	_, _, err := compileIgnoreRule("[abc", "")
+	assert.Error(t, err)
+}
+
+func Test_fileFilter(t *testing.T) {
+	f, err := newFileFilter(nil, []string{"*.log", "!keep.log", "build/"}, true)
+	assert.NoError(t, err)
+
+	assert.True(t, f.excluded("debug.log", false))
+	assert.False(t, f.excluded("keep.log", false))
+	assert.True(t, f.excluded("build", true))
+	assert.False(t, f.excluded("build", false))
+	assert.True(t, f.excluded(".git", true))
+	assert.True(t, f.excluded("sub/.DS_Store", false))
+	assert.True(t, f.included("anything"))
+
+	f, err = newFileFilter([]string{"*.html", "assets/**"}, nil, true)
+	assert.NoError(t, err)
+	assert.True(t, f.included("index.html"))
+	assert.True(t, f.included("assets/img/logo.png"))
+	assert.False(t, f.included("main.js"))
+
+	f, err = newFileFilter([]string{"assets/"}, nil, true)
+	assert.NoError(t, err)
+	assert.True(t, f.included("assets/logo.png"))
+	assert.True(t, f.included("assets/img/logo.png"))
+	assert.True(t, f.included("src/assets/logo.png"))
+	assert.False(t, f.included("assets"))
+	assert.False(t, f.included("index.html"))
+
+	// the pattern filter has no bundle defaults
+	f, err = newPatternFilter(nil, []string{"test/"})
+	assert.NoError(t, err)
+	assert.False(t, f.excluded("app.js.map", false))
+	assert.False(t, f.excluded(".gitignore", false))
+	assert.True(t, f.excluded("test", true))
+	assert.Empty(t, f.ignoreFiles)
+}
@@ -25,6 +25,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"sigs.k8s.io/yaml"
 )
 
 type KindConfig struct {
@@ -34,8 +36,58 @@ type KindConfig struct {
 	nuvolarisConfigDir   string
 	kindConfigFile       string
 	fullConfigPath       string
-	preflightChecks      func(*Logger, string) error
+	preflightChecks      func(*Logger, string, *kindClusterConfig, bool, bool) error
 	kind                 func(...string) error
+	docker               func(...string) (string, error)
+	portBound            func(int) bool
+	kubeClient           func(string) (*KubeClient, error)
+	topology             devClusterTopology
+	remapPorts           bool
+}
+
+// kindClusterConfig is the subset of the kind cluster configuration used by nuv
+type kindClusterConfig struct {
+	Kind       string           `json:"kind"`
+	APIVersion string           `json:"apiVersion"`
+	Name       string           `json:"name"`
+	Networking kindNetworking   `json:"networking,omitempty"`
+	Nodes      []kindNodeConfig `json:"nodes"`
+
+	ContainerdConfigPatches []string `json:"containerdConfigPatches,omitempty"`
+}
+
+type kindNetworking struct {
+	APIServerAddress string `json:"apiServerAddress,omitempty"`
+	APIServerPort    int    `json:"apiServerPort,omitempty"`
+}
+
+type kindNodeConfig struct {
+	Role                 string            `json:"role"`
+	Image                string            `json:"image,omitempty"`
+	KubeadmConfigPatches []string          `json:"kubeadmConfigPatches,omitempty"`
+	ExtraPortMappings    []kindPortMapping `json:"extraPortMappings,omitempty"`
+	ExtraMounts          []kindMount       `json:"extraMounts,omitempty"`
+}
+
+type kindPortMapping struct {
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort"`
+	ListenAddress string `json:"listenAddress,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type kindMount struct {
+	HostPath      string `json:"hostPath"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly,omitempty"`
+}
+
+func parseKindConfig(data []byte) (*kindClusterConfig, error) {
+	var cfg kindClusterConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid kind configuration: %w", err)
+	}
+	return &cfg, nil
 }
 
 //go:embed embed/kind.yaml
@@ -48,6 +100,11 @@ func configKind() (*KindConfig, error) {
 		return nil, err
 	}
 
+	topology, err := readDevClusterTopology(filepath.Join(homeDir, ".nuvolaris"))
+	if err != nil {
+		return nil, err
+	}
+
 	config := KindConfig{
 		homedir:              homeDir,
 		kindYaml:             kindYaml,
@@ -56,6 +113,10 @@ func configKind() (*KindConfig, error) {
 		fullConfigPath:       "",
 		preflightChecks:      RunPreflightChecks,
 		kind:                 Kind,
+		docker:               dockerCommand,
+		portBound:            isPortBound,
+		kubeClient:           kubeClientForContext,
+		topology:             topology,
 	}
 	return &config, nil
 }
@@ -72,8 +133,15 @@ func (config *KindConfig) manageKindCluster(logger *Logger, action string) error
 		if err := config.destroyCluster(); err != nil {
 			return err
 		}
+		config.destroyRegistry(logger)
 		return nil
 	}
+	if action == "stop" {
+		return config.suspendCluster()
+	}
+	if action == "start" {
+		return config.resumeCluster(logger)
+	}
 	fmt.Println("subcommand not available")
 	return nil
 }
@@ -85,27 +153,58 @@ func (config *KindConfig) createCluster(logger *Logger) (err error) {
 		}
 	}()
 
+	if err = config.topology.validate(); err != nil {
+		return err
+	}
+
 	clusterIsRunning, err := config.clusterAlreadyRunning()
 	if err != nil {
 		return err
 	}
 	if clusterIsRunning {
+		stopped, err := config.clusterStopped()
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return fmt.Errorf("kind cluster %s is stopped, start it with nuv devcluster start", config.nuvolarisClusterName)
+		}
 		logger.Info("nuvolaris kind cluster is already running...skipping")
 		return nil
 	}
 
+	kindCfg, err := config.renderKindConfig()
+	if err != nil {
+		return err
+	}
+
 	logger.Info("Running Preflight checks...")
-	if err = config.preflightChecks(logger, config.homedir); err != nil {
+	if err = config.preflightChecks(logger, config.homedir, kindCfg, config.remapPorts, config.topology.Registry); err != nil {
 		return err
 	}
 	logger.Info("Preflight checks passed!")
 
+	if config.topology.Registry {
+		var created bool
+		if created, err = config.startRegistry(logger); err != nil {
+			return err
+		}
+		if created {
+			// a failed cluster must not leave the registry holding its port
+			defer func() {
+				if err != nil {
+					config.removeRegistry(logger)
+				}
+			}()
+		}
+	}
+
 	_, err = GetOrCreateNuvolarisConfigDir()
 	if err != nil {
 		return err
 	}
 
-	fullConfigPath, err := config.rewriteKindConfigFile()
+	fullConfigPath, err := config.rewriteKindConfigFile(kindCfg)
 	if err != nil {
 		return err
 	}
@@ -117,6 +216,12 @@ func (config *KindConfig) createCluster(logger *Logger) (err error) {
 		return err
 	}
 
+	if config.topology.Registry {
+		if err = config.connectRegistry(logger); err != nil {
+			return err
+		}
+	}
+
 	logger.Info("Nuvolaris kind cluster started. Have a nice day! 👋")
 	return nil
 }
@@ -174,16 +279,22 @@ func (config *KindConfig) clusterAlreadyRunning() (bool, error) {
 	}
 }
 
-func (config *KindConfig) rewriteKindConfigFile() (string, error) {
-	nuvHomedir, err := GetOrCreateNuvolarisConfigDir()
+// clusterStopped tells if some node of the existing cluster is not running
+func (config *KindConfig) clusterStopped() (bool, error) {
+	nodes, err := config.nodeStatus()
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	path := filepath.Join(nuvHomedir, config.kindConfigFile)
-	if _, err := os.Stat(path); err == nil {
-		os.Remove(path)
+	for _, node := range nodes {
+		if node.State != "running" {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
+// renderKindConfig merges the devcluster topology into the kind configuration
+func (config *KindConfig) renderKindConfig() (*kindClusterConfig, error) {
 	// set the path for the data dir
 	dataDir := filepath.Join(config.homedir, ".nuvolaris_data")
 	// here docker is remote to we cannot know the remote home and we use /tmp
@@ -191,7 +302,31 @@ func (config *KindConfig) rewriteKindConfigFile() (string, error) {
 		dataDir = "/tmp/nuvolaris_data"
 	}
 	replacedConfigYaml := strings.ReplaceAll(string(config.kindYaml), "$NUV_DATA_DIR", dataDir)
-	if err := os.WriteFile(path, []byte(replacedConfigYaml), 0600); err != nil {
+	kindCfg, err := parseKindConfig([]byte(replacedConfigYaml))
+	if err != nil {
+		return nil, err
+	}
+	if err := config.topology.apply(kindCfg); err != nil {
+		return nil, err
+	}
+	return kindCfg, nil
+}
+
+func (config *KindConfig) rewriteKindConfigFile(kindCfg *kindClusterConfig) (string, error) {
+	nuvHomedir, err := GetOrCreateNuvolarisConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(nuvHomedir, config.kindConfigFile)
+	data, err := yaml.Marshal(kindCfg)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(path)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
 		return "", err
 	}
 	fmt.Println(config.kindConfigFile + " written")
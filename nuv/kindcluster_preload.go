@@ -0,0 +1,169 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+	kindlog "sigs.k8s.io/kind/pkg/log"
+)
+
+const (
+	preloadLoaded  = "preloaded"
+	preloadPulled  = "pulled and preloaded"
+	preloadPresent = "already in the cluster"
+	preloadMissing = "not in the docker cache, use --pull"
+)
+
+// imagePreloader side-loads images of the docker cache into the kind nodes,
+// as kind load docker-image does
+type imagePreloader struct {
+	cluster string
+	pull    bool
+	docker  func(...string) (string, error)
+	nodes   func(cluster string) ([]nodes.Node, error)
+	imageID func(node nodes.Node, image string) (string, error)
+	load    func(node nodes.Node, archive string) error
+}
+
+type preloadResult struct {
+	image  string
+	status string
+}
+
+func newImagePreloader(pull bool) *imagePreloader {
+	provider := cluster.NewProvider(cluster.ProviderWithLogger(kindlog.NoopLogger{}))
+	return &imagePreloader{
+		cluster: "nuvolaris",
+		pull:    pull,
+		docker:  dockerCommand,
+		nodes:   provider.ListInternalNodes,
+		imageID: nodeutils.ImageID,
+		load:    loadImageArchive,
+	}
+}
+
+// preloadDevClusterImages preloads the images into the devcluster and reports them
+func preloadDevClusterImages(logger *Logger, images []string, pull bool) error {
+	logger.Info("Preloading images into the devcluster...")
+	results, err := newImagePreloader(pull).preload(images)
+	if results != nil {
+		writePreloadResults(os.Stdout, results)
+	}
+	return err
+}
+
+// preload reports every image and fails when some of them are not in the
+// cluster at the end, including the ones missing from the docker cache
+func (p *imagePreloader) preload(images []string) ([]preloadResult, error) {
+	kindNodes, err := p.nodes(p.cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the nodes of the %s cluster: %w", p.cluster, err)
+	}
+	if len(kindNodes) == 0 {
+		return nil, fmt.Errorf("no nodes found for the %s cluster", p.cluster)
+	}
+
+	archive, err := os.MkdirTemp("", "nuv-preload")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(archive)
+
+	results := []preloadResult{}
+	failed := []string{}
+	for i, image := range images {
+		status, err := p.preloadImage(kindNodes, image, filepath.Join(archive, fmt.Sprintf("image-%d.tar", i)))
+		if err != nil {
+			status = "failed: " + err.Error()
+		}
+		if err != nil || status == preloadMissing {
+			failed = append(failed, image)
+		}
+		results = append(results, preloadResult{image: image, status: status})
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("cannot preload %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+func (p *imagePreloader) preloadImage(kindNodes []nodes.Node, image string, archive string) (string, error) {
+	loaded := preloadLoaded
+	id, err := p.docker("image", "inspect", "-f", "{{.Id}}", image)
+	if err != nil {
+		if !p.pull {
+			return preloadMissing, nil
+		}
+		if _, err := p.docker("pull", image); err != nil {
+			return "", fmt.Errorf("cannot pull the image: %w", err)
+		}
+		if id, err = p.docker("image", "inspect", "-f", "{{.Id}}", image); err != nil {
+			return "", err
+		}
+		loaded = preloadPulled
+	}
+	id = strings.TrimSpace(id)
+
+	// only the nodes without this exact image need it
+	missing := []nodes.Node{}
+	for _, node := range kindNodes {
+		if nodeID, err := p.imageID(node, image); err != nil || nodeID != id {
+			missing = append(missing, node)
+		}
+	}
+	if len(missing) == 0 {
+		return preloadPresent, nil
+	}
+
+	if _, err := p.docker("save", "-o", archive, image); err != nil {
+		return "", fmt.Errorf("cannot save the image: %w", err)
+	}
+	for _, node := range missing {
+		if err := p.load(node, archive); err != nil {
+			return "", fmt.Errorf("cannot load the image into %s: %w", node.String(), err)
+		}
+	}
+	return loaded, nil
+}
+
+func loadImageArchive(node nodes.Node, archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return nodeutils.LoadImageArchive(node, f)
+}
+
+func writePreloadResults(out io.Writer, results []preloadResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "IMAGE\tSTATUS")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\n", result.image, result.status)
+	}
+}
@@ -0,0 +1,136 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// fakeNode is a kind node knowing only its name
+type fakeNode struct {
+	nodes.Node
+	name string
+}
+
+func (n fakeNode) String() string {
+	return n.name
+}
+
+// fakePreloader has the images of cache in the docker cache, the ones
+// of registry pullable and the ones of the nodeImages in each node
+func fakePreloader(pull bool, cache map[string]string, registry map[string]string, nodeImages map[string]map[string]string) (*imagePreloader, *[]string) {
+	loaded := []string{}
+	return &imagePreloader{
+		cluster: "nuvolaris",
+		pull:    pull,
+		docker: func(args ...string) (string, error) {
+			image := args[len(args)-1]
+			switch args[0] {
+			case "image":
+				if id, ok := cache[image]; ok {
+					return id + "\n", nil
+				}
+				return "", fmt.Errorf("exit status 1")
+			case "pull":
+				if id, ok := registry[image]; ok {
+					cache[image] = id
+					return "", nil
+				}
+				return "", fmt.Errorf("exit status 1")
+			}
+			return "", nil
+		},
+		nodes: func(string) ([]nodes.Node, error) {
+			return []nodes.Node{fakeNode{name: "nuvolaris-control-plane"}, fakeNode{name: "nuvolaris-worker"}}, nil
+		},
+		imageID: func(node nodes.Node, image string) (string, error) {
+			if id, ok := nodeImages[node.String()][image]; ok {
+				return id, nil
+			}
+			return "", fmt.Errorf("not found")
+		},
+		load: func(node nodes.Node, archive string) error {
+			loaded = append(loaded, node.String())
+			return nil
+		},
+	}, &loaded
+}
+
+func Test_preloadImages(t *testing.T) {
+	t.Run("should load the cached images in the nodes without them", func(t *testing.T) {
+		p, loaded := fakePreloader(false,
+			map[string]string{"operator:1": "sha256:1", "nodejs:1": "sha256:2"}, nil,
+			map[string]map[string]string{"nuvolaris-control-plane": {"operator:1": "sha256:1", "nodejs:1": "sha256:old"}})
+		results, err := p.preload([]string{"operator:1", "nodejs:1", "python:1"})
+		assert.EqualError(t, err, "cannot preload python:1")
+		assert.Equal(t, []preloadResult{
+			{"operator:1", preloadLoaded},
+			{"nodejs:1", preloadLoaded},
+			{"python:1", preloadMissing},
+		}, results)
+		assert.Equal(t, []string{"nuvolaris-worker", "nuvolaris-control-plane", "nuvolaris-worker"}, *loaded)
+	})
+
+	t.Run("should pull the missing images when allowed", func(t *testing.T) {
+		p, loaded := fakePreloader(true, map[string]string{}, map[string]string{"operator:1": "sha256:1"}, nil)
+		results, err := p.preload([]string{"operator:1", "python:1"})
+		assert.EqualError(t, err, "cannot preload python:1")
+		assert.Equal(t, preloadResult{"operator:1", preloadPulled}, results[0])
+		assert.Equal(t, preloadResult{"python:1", "failed: cannot pull the image: exit status 1"}, results[1])
+		assert.Len(t, *loaded, 2)
+	})
+
+	t.Run("should skip the images already in the cluster", func(t *testing.T) {
+		p, loaded := fakePreloader(false, map[string]string{"operator:1": "sha256:1"}, nil, map[string]map[string]string{
+			"nuvolaris-control-plane": {"operator:1": "sha256:1"},
+			"nuvolaris-worker":        {"operator:1": "sha256:1"},
+		})
+		results, err := p.preload([]string{"operator:1"})
+		assert.NoError(t, err)
+		assert.Equal(t, []preloadResult{{"operator:1", preloadPresent}}, results)
+		assert.Empty(t, *loaded)
+	})
+
+	t.Run("should fail without the cluster", func(t *testing.T) {
+		p, _ := fakePreloader(false, nil, nil, nil)
+		p.nodes = func(string) ([]nodes.Node, error) { return nil, nil }
+		_, err := p.preload([]string{"operator:1"})
+		assert.EqualError(t, err, "no nodes found for the nuvolaris cluster")
+	})
+}
+
+func Test_setupPreloadNeedsDevcluster(t *testing.T) {
+	err := setupNuvolaris(NewLogger(), &SetupCmd{Preload: true, Context: "other"})
+	assert.EqualError(t, err, "--preload is only available with --devcluster")
+}
+
+func Example_writePreloadResults() {
+	writePreloadResults(os.Stdout, []preloadResult{
+		{"ghcr.io/nuvolaris/nuvolaris-operator:0.2.1", preloadPulled},
+		{"openwhisk/action-nodejs-v14:nightly", preloadMissing},
+	})
+	// Output:
+	// IMAGE                                       STATUS
+	// ghcr.io/nuvolaris/nuvolaris-operator:0.2.1  pulled and preloaded
+	// openwhisk/action-nodejs-v14:nightly         not in the docker cache, use --pull
+}
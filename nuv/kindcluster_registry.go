@@ -0,0 +1,128 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const registryName = "nuvolaris-registry"
+const registryImage = "registry:2"
+const registryPort = 5001
+const registryConfigmapName = "local-registry-hosting"
+const kindNetwork = "kind"
+
+// registryHost is where the images are pushed on the host and pulled in the cluster
+var registryHost = fmt.Sprintf("localhost:%d", registryPort)
+
+// registryContainerdPatch makes containerd pull the images of the
+// registry host from the registry container on the kind network
+func registryContainerdPatch() string {
+	return fmt.Sprintf("[plugins.\"io.containerd.grpc.v1.cri\".registry.mirrors.\"%s\"]\n  endpoint = [\"http://%s:5000\"]",
+		registryHost, registryName)
+}
+
+// startRegistry starts the registry container, reusing it when it already exists;
+// it tells if the container was created, to remove it when the cluster fails
+func (config *KindConfig) startRegistry(logger *Logger) (bool, error) {
+	created := false
+	running, err := config.docker("inspect", "-f", "{{.State.Running}}", registryName)
+	switch {
+	case err == nil && strings.TrimSpace(running) == "true":
+		logger.Info("Local registry already running on " + registryHost)
+		return false, nil
+	case err == nil:
+		_, err = config.docker("start", registryName)
+	default:
+		created = true
+		_, err = config.docker("run", "-d", "--restart=always",
+			"-p", fmt.Sprintf("127.0.0.1:%d:5000", registryPort),
+			"--name", registryName, registryImage)
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot start the local registry: %w", err)
+	}
+	logger.Info("Local registry started on " + registryHost)
+	return created, nil
+}
+
+// removeRegistry removes the registry container, freeing its port
+func (config *KindConfig) removeRegistry(logger *Logger) {
+	if _, err := config.docker("rm", "-f", registryName); err != nil {
+		logger.Infof("cannot remove the local registry, remove it with docker rm -f %s: %v", registryName, err)
+		return
+	}
+	logger.Info("Local registry removed")
+}
+
+// destroyRegistry removes the registry of a cluster created with --registry,
+// as it restarts with docker and keeps its port busy
+func (config *KindConfig) destroyRegistry(logger *Logger) {
+	if _, err := config.docker("inspect", "-f", "{{.State.Running}}", registryName); err != nil {
+		return
+	}
+	config.removeRegistry(logger)
+}
+
+// connectRegistry attaches the registry to the kind network and
+// documents it in the cluster with the local-registry-hosting config map
+func (config *KindConfig) connectRegistry(logger *Logger) error {
+	network, err := config.docker("inspect", "-f", "{{json .NetworkSettings.Networks."+kindNetwork+"}}", registryName)
+	if err != nil {
+		return fmt.Errorf("cannot inspect the local registry: %w", err)
+	}
+	if strings.TrimSpace(network) == "null" {
+		if _, err := config.docker("network", "connect", kindNetwork, registryName); err != nil {
+			return fmt.Errorf("cannot connect the local registry to the %s network: %w", kindNetwork, err)
+		}
+	}
+
+	c, err := config.kubeClient("kind-" + config.nuvolarisClusterName)
+	if err != nil {
+		return err
+	}
+	if err := publishRegistryHosting(c); err != nil {
+		return fmt.Errorf("cannot publish the local registry: %w", err)
+	}
+	logger.Info("Images pushed to " + registryHost + " can be pulled in the cluster")
+	return nil
+}
+
+// publishRegistryHosting creates or updates the config map of KEP-1755
+func publishRegistryHosting(c *KubeClient) error {
+	configmap := &coreV1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      registryConfigmapName,
+			Namespace: metaV1.NamespacePublic,
+		},
+		Data: map[string]string{
+			"localRegistryHosting.v1": fmt.Sprintf("host: %q\nhelp: \"https://kind.sigs.k8s.io/docs/user/local-registry/\"\n", registryHost),
+		},
+	}
+	configmaps := c.clientset.CoreV1().ConfigMaps(metaV1.NamespacePublic)
+	_, err := configmaps.Create(c.ctx, configmap, metaV1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = configmaps.Update(c.ctx, configmap, metaV1.UpdateOptions{})
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeDocker records the docker commands and answers by subcommand
+func fakeDocker(calls *[]string, answers map[string]string) func(...string) (string, error) {
+	return func(args ...string) (string, error) {
+		*calls = append(*calls, strings.Join(args, " "))
+		answer, ok := answers[args[0]]
+		if !ok {
+			return "", nil
+		}
+		if strings.HasPrefix(answer, "!") {
+			return "", fmt.Errorf("%s", answer[1:])
+		}
+		return answer, nil
+	}
+}
+
+func Test_startRegistry(t *testing.T) {
+	var calls []string
+	config := KindConfig{docker: fakeDocker(&calls, map[string]string{"inspect": "!no such object"})}
+	created, err := config.startRegistry(NewLogger())
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "run -d --restart=always -p 127.0.0.1:5001:5000 --name nuvolaris-registry registry:2", calls[1])
+
+	calls = nil
+	config.docker = fakeDocker(&calls, map[string]string{"inspect": "false\n"})
+	created, err = config.startRegistry(NewLogger())
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, []string{"inspect -f {{.State.Running}} nuvolaris-registry", "start nuvolaris-registry"}, calls)
+
+	calls = nil
+	config.docker = fakeDocker(&calls, map[string]string{"inspect": "true\n"})
+	created, err = config.startRegistry(NewLogger())
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Len(t, calls, 1)
+
+	config.docker = fakeDocker(&calls, map[string]string{"inspect": "!no such object", "run": "!exit status 125"})
+	_, err = config.startRegistry(NewLogger())
+	assert.ErrorContains(t, err, "cannot start the local registry: exit status 125")
+}
+
+func Test_createClusterRemovesRegistry(t *testing.T) {
+	newConfig := func(calls *[]string, inspect string) KindConfig {
+		return KindConfig{
+			homedir:              homeDir,
+			kindYaml:             kindYaml,
+			nuvolarisClusterName: "nuvolaris",
+			kindConfigFile:       "kind.yaml",
+			topology:             devClusterTopology{Registry: true},
+			preflightChecks: func(*Logger, string, *kindClusterConfig, bool, bool) error {
+				return nil
+			},
+			kind: func(args ...string) error {
+				if args[0] == "create" {
+					return fmt.Errorf("node(s) already exist")
+				}
+				return nil
+			},
+			docker: fakeDocker(calls, map[string]string{"inspect": inspect}),
+		}
+	}
+
+	var calls []string
+	config := newConfig(&calls, "!no such object")
+	assert.ErrorContains(t, config.createCluster(NewLogger()), "node(s) already exist")
+	assert.Equal(t, "rm -f nuvolaris-registry", calls[len(calls)-1])
+
+	// a registry that was already there is left alone
+	calls = nil
+	config = newConfig(&calls, "true\n")
+	assert.Error(t, config.createCluster(NewLogger()))
+	assert.Equal(t, []string{"inspect -f {{.State.Running}} nuvolaris-registry"}, calls)
+}
+
+func Test_destroyRemovesRegistry(t *testing.T) {
+	restore := GetHomeDir
+	GetHomeDir = func() (string, error) { return t.TempDir(), nil }
+	t.Cleanup(func() { GetHomeDir = restore })
+	var calls []string
+	config := KindConfig{
+		nuvolarisClusterName: "nuvolaris",
+		kind:                 func(...string) error { return nil },
+		docker:               fakeDocker(&calls, map[string]string{"inspect": "true\n"}),
+	}
+	assert.NoError(t, config.manageKindCluster(NewLogger(), "destroy"))
+	assert.Equal(t, []string{"inspect -f {{.State.Running}} nuvolaris-registry", "rm -f nuvolaris-registry"}, calls)
+
+	// without a registry there is nothing to remove
+	calls = nil
+	config.docker = fakeDocker(&calls, map[string]string{"inspect": "!no such object"})
+	assert.NoError(t, config.manageKindCluster(NewLogger(), "destroy"))
+	assert.Len(t, calls, 1)
+}
+
+func Test_connectRegistry(t *testing.T) {
+	var calls []string
+	clientset := fakeclient.NewSimpleClientset(&coreV1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{Name: registryConfigmapName, Namespace: metaV1.NamespacePublic},
+		Data:       map[string]string{"localRegistryHosting.v1": "host: \"localhost:5000\"\n"},
+	})
+	var usedContext string
+	config := KindConfig{
+		nuvolarisClusterName: "nuvolaris",
+		docker:               fakeDocker(&calls, map[string]string{"inspect": "null\n"}),
+		kubeClient: func(k8sContext string) (*KubeClient, error) {
+			usedContext = k8sContext
+			return &KubeClient{clientset: clientset, ctx: context.Background()}, nil
+		},
+	}
+	assert.NoError(t, config.connectRegistry(NewLogger()))
+	assert.Equal(t, "network connect kind nuvolaris-registry", calls[1])
+	assert.Equal(t, "kind-nuvolaris", usedContext)
+
+	configmap, err := clientset.CoreV1().ConfigMaps(metaV1.NamespacePublic).Get(context.Background(), registryConfigmapName, metaV1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "host: \"localhost:5001\"\nhelp: \"https://kind.sigs.k8s.io/docs/user/local-registry/\"\n", configmap.Data["localRegistryHosting.v1"])
+
+	calls = nil
+	config.docker = fakeDocker(&calls, map[string]string{"inspect": `{"NetworkID":"abc"}`})
+	assert.NoError(t, config.connectRegistry(NewLogger()))
+	assert.Len(t, calls, 1)
+}
+
+func Test_applyTopologyWithRegistry(t *testing.T) {
+	cfg := embeddedKindConfig(t)
+	assert.NoError(t, devClusterTopology{Registry: true}.apply(cfg))
+	assert.Equal(t, []string{"[plugins.\"io.containerd.grpc.v1.cri\".registry.mirrors.\"localhost:5001\"]\n  endpoint = [\"http://nuvolaris-registry:5000\"]"}, cfg.ContainerdConfigPatches)
+}
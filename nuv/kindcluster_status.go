@@ -0,0 +1,281 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// nuvolarisPods are the pods reported by the status, by component
+var nuvolarisPods = []struct{ component, pod string }{
+	{"operator", operatorName},
+	{"controller", "controller-0"},
+	{"couchdb", "couchdb-0"},
+	{"redis", "redis-0"},
+}
+
+type clusterStatus struct {
+	Cluster string        `json:"cluster"`
+	Exists  bool          `json:"exists"`
+	Context contextStatus `json:"context"`
+	Nodes   []nodeStatus  `json:"nodes"`
+	Ports   []portStatus  `json:"ports"`
+	Pods    []podStatus   `json:"pods"`
+}
+
+type contextStatus struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type nodeStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+type portStatus struct {
+	Node          string `json:"node"`
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	Bound         bool   `json:"bound"`
+}
+
+type podStatus struct {
+	Component string `json:"component"`
+	Pod       string `json:"pod"`
+	Phase     string `json:"phase"`
+}
+
+// isPortBound checks if something is listening on the host port
+func isPortBound(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 300*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (config *KindConfig) printClusterStatus(out io.Writer, output string) error {
+	status, err := config.clusterStatus()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	writeClusterStatus(out, status)
+	return nil
+}
+
+func (config *KindConfig) clusterStatus() (*clusterStatus, error) {
+	status := clusterStatus{
+		Cluster: config.nuvolarisClusterName,
+		Context: contextStatus{Name: "kind-" + config.nuvolarisClusterName},
+		Nodes:   []nodeStatus{},
+		Ports:   []portStatus{},
+		Pods:    []podStatus{},
+	}
+	exists, err := config.clusterAlreadyRunning()
+	if err != nil {
+		return nil, err
+	}
+	status.Exists = exists
+
+	kindCfg, err := parseKindConfig(config.currentKindYaml())
+	if err != nil {
+		return nil, err
+	}
+	status.Ports = config.portStatus(kindCfg)
+
+	if !exists {
+		return &status, nil
+	}
+	if status.Nodes, err = config.nodeStatus(); err != nil {
+		return nil, err
+	}
+	status.Context, status.Pods = config.componentStatus(status.Context.Name)
+	return &status, nil
+}
+
+// currentKindYaml prefers the configuration written by create over the embedded one
+func (config *KindConfig) currentKindYaml() []byte {
+	path := filepath.Join(config.homedir, ".nuvolaris", config.kindConfigFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return data
+	}
+	return config.kindYaml
+}
+
+func (config *KindConfig) nodeStatus() ([]nodeStatus, error) {
+	out, err := config.docker("ps", "-a",
+		"--filter", "label=io.x-k8s.kind.cluster="+config.nuvolarisClusterName,
+		"--format", "{{.Names}}\t{{.State}}")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the cluster nodes: %w", err)
+	}
+	nodes := []nodeStatus{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		name, state, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		nodes = append(nodes, nodeStatus{Name: name, State: state})
+	}
+	return nodes, nil
+}
+
+// kindNodeNames returns the container names kind gives to the nodes, in order
+func kindNodeNames(cluster string, nodes []kindNodeConfig) []string {
+	names := make([]string, len(nodes))
+	count := map[string]int{}
+	for i, node := range nodes {
+		count[node.Role]++
+		names[i] = cluster + "-" + node.Role
+		if count[node.Role] > 1 {
+			names[i] += strconv.Itoa(count[node.Role])
+		}
+	}
+	return names
+}
+
+func (config *KindConfig) portStatus(kindCfg *kindClusterConfig) []portStatus {
+	ports := []portStatus{}
+	names := kindNodeNames(config.nuvolarisClusterName, kindCfg.Nodes)
+	if kindCfg.Networking.APIServerPort > 0 && len(names) > 0 {
+		ports = append(ports, portStatus{
+			Node:          names[0],
+			HostPort:      kindCfg.Networking.APIServerPort,
+			ContainerPort: 6443,
+			Protocol:      "TCP",
+			Bound:         config.portBound(kindCfg.Networking.APIServerPort),
+		})
+	}
+	for i, node := range kindCfg.Nodes {
+		for _, mapping := range node.ExtraPortMappings {
+			protocol := mapping.Protocol
+			if protocol == "" {
+				protocol = "TCP"
+			}
+			ports = append(ports, portStatus{
+				Node:          names[i],
+				HostPort:      mapping.HostPort,
+				ContainerPort: mapping.ContainerPort,
+				Protocol:      protocol,
+				Bound:         config.portBound(mapping.HostPort),
+			})
+		}
+	}
+	return ports
+}
+
+func (config *KindConfig) componentStatus(k8sContext string) (contextStatus, []podStatus) {
+	ctxStatus := contextStatus{Name: k8sContext}
+	pods := []podStatus{}
+	for _, p := range nuvolarisPods {
+		pods = append(pods, podStatus{Component: p.component, Pod: p.pod, Phase: "Unknown"})
+	}
+
+	c, err := config.kubeClient(k8sContext)
+	if err != nil {
+		ctxStatus.Error = err.Error()
+		return ctxStatus, pods
+	}
+	version, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		ctxStatus.Error = err.Error()
+		return ctxStatus, pods
+	}
+	ctxStatus.Reachable = true
+	ctxStatus.Version = version.GitVersion
+
+	for i := range pods {
+		pod, err := getPod(c, pods[i].Pod)
+		switch {
+		case errors.IsNotFound(err):
+			pods[i].Phase = "Missing"
+		case err == nil:
+			pods[i].Phase = string(pod.Status.Phase)
+			if pod.DeletionTimestamp != nil {
+				pods[i].Phase = "Terminating"
+			} else if pod.Status.Phase == "" {
+				pods[i].Phase = string(coreV1.PodPending)
+			}
+		}
+	}
+	return ctxStatus, pods
+}
+
+func writeClusterStatus(out io.Writer, status *clusterStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if !status.Exists {
+		fmt.Fprintf(w, "cluster %s: not found\n", status.Cluster)
+	} else {
+		fmt.Fprintf(w, "cluster %s: exists\n", status.Cluster)
+		if status.Context.Reachable {
+			fmt.Fprintf(w, "context %s: reachable (%s)\n", status.Context.Name, status.Context.Version)
+		} else {
+			fmt.Fprintf(w, "context %s: %s\n", status.Context.Name, status.Context.Error)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "NODE\tSTATE")
+		for _, node := range status.Nodes {
+			fmt.Fprintf(w, "%s\t%s\n", node.Name, node.State)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NODE\tHOST PORT\tCONTAINER PORT\tPROTOCOL\tBOUND")
+	for _, port := range status.Ports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", port.Node, port.HostPort, port.ContainerPort, port.Protocol, yesNo(port.Bound))
+	}
+
+	if status.Exists {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "COMPONENT\tPOD\tPHASE")
+		for _, pod := range status.Pods {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", pod.Component, pod.Pod, pod.Phase)
+		}
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func statusPod(name string, phase coreV1.PodPhase) *coreV1.Pod {
+	return &coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: NuvolarisNamespace},
+		Status:     coreV1.PodStatus{Phase: phase},
+	}
+}
+
+func statusKindConfig(homedir string, running bool) *KindConfig {
+	return &KindConfig{
+		homedir:              homedir,
+		kindYaml:             kindYaml,
+		nuvolarisClusterName: "nuvolaris",
+		kindConfigFile:       "kind.yaml",
+		kind: func(...string) error {
+			if running {
+				fmt.Println("nuvolaris")
+			}
+			return nil
+		},
+		docker: func(...string) (string, error) {
+			return "nuvolaris-control-plane\trunning\nnuvolaris-worker\texited\n", nil
+		},
+		portBound: func(port int) bool {
+			return port == 16443 || port == 80
+		},
+		kubeClient: func(string) (*KubeClient, error) {
+			clientset := fakeclient.NewSimpleClientset(
+				statusPod(operatorName, coreV1.PodRunning),
+				statusPod("controller-0", coreV1.PodPending),
+				statusPod("couchdb-0", coreV1.PodRunning),
+			)
+			clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.24.0"}
+			return &KubeClient{clientset: clientset, namespace: NuvolarisNamespace, ctx: context.Background()}, nil
+		},
+	}
+}
+
+func Test_clusterStatus(t *testing.T) {
+	status, err := statusKindConfig(t.TempDir(), true).clusterStatus()
+	assert.NoError(t, err)
+	assert.True(t, status.Exists)
+	assert.Equal(t, contextStatus{Name: "kind-nuvolaris", Reachable: true, Version: "v1.24.0"}, status.Context)
+	assert.Equal(t, []nodeStatus{{"nuvolaris-control-plane", "running"}, {"nuvolaris-worker", "exited"}}, status.Nodes)
+	assert.Equal(t, portStatus{Node: "nuvolaris-control-plane", HostPort: 16443, ContainerPort: 6443, Protocol: "TCP", Bound: true}, status.Ports[0])
+	assert.Equal(t, portStatus{Node: "nuvolaris-worker", HostPort: 3232, ContainerPort: 30232, Protocol: "TCP"}, status.Ports[1])
+	assert.Len(t, status.Ports, 10)
+	assert.Equal(t, []podStatus{
+		{"operator", operatorName, "Running"},
+		{"controller", "controller-0", "Pending"},
+		{"couchdb", "couchdb-0", "Running"},
+		{"redis", "redis-0", "Missing"},
+	}, status.Pods)
+}
+
+func Test_clusterStatusUnreachableContext(t *testing.T) {
+	config := statusKindConfig(t.TempDir(), true)
+	config.kubeClient = func(string) (*KubeClient, error) {
+		return nil, fmt.Errorf("context not found")
+	}
+	status, err := config.clusterStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, contextStatus{Name: "kind-nuvolaris", Error: "context not found"}, status.Context)
+	assert.Equal(t, "Unknown", status.Pods[0].Phase)
+}
+
+func Test_clusterStatusNotFound(t *testing.T) {
+	config := statusKindConfig(t.TempDir(), false)
+	assert.NoError(t, os.MkdirAll(filepath.Join(config.homedir, ".nuvolaris"), 0755))
+	written := "kind: Cluster\nname: nuvolaris\nnodes:\n- role: control-plane\n  extraPortMappings:\n  - containerPort: 80\n    hostPort: 8080\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(config.homedir, ".nuvolaris", "kind.yaml"), []byte(written), 0600))
+
+	var out bytes.Buffer
+	assert.NoError(t, config.printClusterStatus(&out, "json"))
+	var status clusterStatus
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &status))
+	assert.False(t, status.Exists)
+	assert.Empty(t, status.Nodes)
+	assert.Empty(t, status.Pods)
+	assert.Equal(t, []portStatus{{Node: "nuvolaris-control-plane", HostPort: 8080, ContainerPort: 80, Protocol: "TCP"}}, status.Ports)
+}
+
+func Example_printClusterStatus() {
+	config := statusKindConfig(filepath.Join(os.TempDir(), "nuv-status-example"), true)
+	config.kindYaml = []byte("kind: Cluster\nnetworking:\n  apiServerPort: 16443\nnodes:\n- role: control-plane\n- role: worker\n  extraPortMappings:\n  - containerPort: 80\n    hostPort: 80\n  - containerPort: 6379\n    hostPort: 30379\n")
+	config.printClusterStatus(os.Stdout, "table")
+	// Output:
+	// cluster nuvolaris: exists
+	// context kind-nuvolaris: reachable (v1.24.0)
+	//
+	// NODE                     STATE
+	// nuvolaris-control-plane  running
+	// nuvolaris-worker         exited
+	//
+	// NODE                     HOST PORT  CONTAINER PORT  PROTOCOL  BOUND
+	// nuvolaris-control-plane  16443      6443            TCP       yes
+	// nuvolaris-worker         80         80              TCP       yes
+	// nuvolaris-worker         30379      6379            TCP       no
+	//
+	// COMPONENT   POD                 PHASE
+	// operator    nuvolaris-operator  Running
+	// controller  controller-0        Pending
+	// couchdb     couchdb-0           Running
+	// redis       redis-0             Missing
+}
@@ -0,0 +1,138 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// apiServerTimeout is how long start waits for the api server to answer
+var apiServerTimeout = 3 * time.Minute
+
+// suspendCluster stops the node containers, keeping the cluster,
+// the data dir and the nuv configuration as they are
+func (config *KindConfig) suspendCluster() error {
+	nodes, err := config.clusterNodes()
+	if err != nil || len(nodes) == 0 {
+		return err
+	}
+	if _, err := config.docker(append([]string{"stop"}, nodes...)...); err != nil {
+		return fmt.Errorf("cannot stop the cluster nodes: %w", err)
+	}
+	fmt.Printf("kind cluster %s stopped, resume it with nuv devcluster start\n", config.nuvolarisClusterName)
+	return nil
+}
+
+// resumeCluster starts the node containers again and waits
+// for the api server and the nuvolaris pods to be back
+func (config *KindConfig) resumeCluster(logger *Logger) error {
+	nodes, err := config.clusterNodes()
+	if err != nil || len(nodes) == 0 {
+		return err
+	}
+	logger.Info("Starting the kind cluster nodes...")
+	// the pod conditions have a precision of seconds
+	started := metaV1.NewTime(time.Now().Truncate(time.Second))
+	if _, err := config.docker(append([]string{"start"}, nodes...)...); err != nil {
+		return fmt.Errorf("cannot start the cluster nodes: %w", err)
+	}
+
+	c, err := config.kubeClient("kind-" + config.nuvolarisClusterName)
+	if err != nil {
+		return err
+	}
+	fmt.Print("Waiting for the api server...")
+	if err := waitForAPIServer(c, apiServerTimeout); err != nil {
+		return fmt.Errorf("the api server did not come back: %w", err)
+	}
+	for _, p := range nuvolarisPods {
+		if _, err := getPod(c, p.pod); errors.IsNotFound(err) {
+			continue
+		}
+		fmt.Printf("\nWaiting for %s Ready...", p.component)
+		if err := waitForPodReadySince(c, p.pod, started); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	logger.Info("Nuvolaris kind cluster started. Have a nice day! 👋")
+	return nil
+}
+
+// clusterNodes returns the node containers, control plane first,
+// or nothing when the cluster does not exist
+func (config *KindConfig) clusterNodes() ([]string, error) {
+	clusterIsRunning, err := config.clusterAlreadyRunning()
+	if err != nil {
+		return nil, err
+	}
+	if !clusterIsRunning {
+		fmt.Printf("kind cluster %s not found...skipping\n", config.nuvolarisClusterName)
+		return nil, nil
+	}
+	status, err := config.nodeStatus()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []string{}
+	for _, node := range status {
+		nodes = append(nodes, node.Name)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return strings.Contains(nodes[i], "control-plane") && !strings.Contains(nodes[j], "control-plane")
+	})
+	return nodes, nil
+}
+
+func waitForAPIServer(c *KubeClient, timeout time.Duration) error {
+	return wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		fmt.Printf(".")
+		_, err := c.clientset.Discovery().ServerVersion()
+		return err == nil, nil
+	})
+}
+
+// waitForPodReadySince waits for the pod to become ready after the nodes restarted,
+// as until the kubelet is back the pod still reports the status before the stop
+func waitForPodReadySince(c *KubeClient, podName string, since metaV1.Time) error {
+	return wait.PollImmediate(time.Second, time.Duration(TimeoutInSec)*time.Second, func() (bool, error) {
+		fmt.Printf(".")
+		pod, err := getPod(c, podName)
+		if err != nil {
+			// the api server can still be warming up
+			return false, nil
+		}
+		if pod.Status.Phase == coreV1.PodFailed {
+			return false, fmt.Errorf("pod %s failed", podName)
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == coreV1.PodReady {
+				return condition.Status == coreV1.ConditionTrue && !condition.LastTransitionTime.Before(&since), nil
+			}
+		}
+		return false, nil
+	})
+}
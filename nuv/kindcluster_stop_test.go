@@ -0,0 +1,106 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func readyPod(name string, transition time.Time) *coreV1.Pod {
+	pod := statusPod(name, coreV1.PodRunning)
+	pod.Status.Conditions = []coreV1.PodCondition{
+		{Type: coreV1.PodReady, Status: coreV1.ConditionTrue, LastTransitionTime: metaV1.NewTime(transition)},
+	}
+	return pod
+}
+
+func stopKindConfig(calls *[]string, running bool) *KindConfig {
+	return &KindConfig{
+		nuvolarisClusterName: "nuvolaris",
+		kind: func(...string) error {
+			if running {
+				fmt.Println("nuvolaris")
+			}
+			return nil
+		},
+		docker: fakeDocker(calls, map[string]string{"ps": "nuvolaris-worker\texited\nnuvolaris-control-plane\texited\n"}),
+		kubeClient: func(string) (*KubeClient, error) {
+			later := time.Now().Add(time.Minute)
+			clientset := fakeclient.NewSimpleClientset(
+				readyPod(operatorName, later),
+				readyPod("controller-0", later),
+				readyPod("couchdb-0", later),
+			)
+			return &KubeClient{clientset: clientset, namespace: NuvolarisNamespace, ctx: context.Background()}, nil
+		},
+	}
+}
+
+func Test_stopClusterKeepsTheConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	restore := GetHomeDir
+	GetHomeDir = func() (string, error) { return dir, nil }
+	defer func() { GetHomeDir = restore }()
+	configYaml := filepath.Join(dir, ".nuvolaris", "config.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(configYaml), 0755))
+	assert.NoError(t, os.WriteFile(configYaml, []byte("apihost: localhost\n"), 0600))
+
+	var calls []string
+	assert.NoError(t, stopKindConfig(&calls, true).manageKindCluster(NewLogger(), "stop"))
+	assert.Equal(t, "stop nuvolaris-control-plane nuvolaris-worker", calls[1])
+	assert.FileExists(t, configYaml)
+}
+
+func Test_resumeCluster(t *testing.T) {
+	var calls []string
+	config := stopKindConfig(&calls, true)
+	assert.NoError(t, config.manageKindCluster(NewLogger(), "start"))
+	assert.Equal(t, "start nuvolaris-control-plane nuvolaris-worker", calls[1])
+}
+
+func Test_waitForPodReadySince(t *testing.T) {
+	since := metaV1.NewTime(time.Now().Truncate(time.Second))
+	c := KubeClient{namespace: NuvolarisNamespace, ctx: context.Background()}
+	c.clientset = fakeclient.NewSimpleClientset(readyPod("couchdb-0", since.Time))
+	assert.NoError(t, waitForPodReadySince(&c, "couchdb-0", since))
+
+	failed := statusPod("couchdb-0", coreV1.PodFailed)
+	c.clientset = fakeclient.NewSimpleClientset(failed)
+	assert.EqualError(t, waitForPodReadySince(&c, "couchdb-0", since), "pod couchdb-0 failed")
+}
+
+func Example_stopClusterNotFound() {
+	var calls []string
+	stopKindConfig(&calls, false).manageKindCluster(NewLogger(), "stop")
+	stopKindConfig(&calls, false).manageKindCluster(NewLogger(), "start")
+	fmt.Println(len(calls))
+	// Output:
+	// kind cluster nuvolaris not found...skipping
+	// kind cluster nuvolaris not found...skipping
+	// 0
+}
@@ -32,12 +32,32 @@ func Example_devClusterAlreadyRunning() {
 			fmt.Println("nuvolaris")
 			return nil
 		},
+		docker: func(...string) (string, error) {
+			return "nuvolaris-control-plane\trunning\n", nil
+		},
 	}
 	config.manageKindCluster(NewLogger(), "create")
 	// Output:
 	// nuvolaris kind cluster is already running...skipping
 }
 
+func Example_devClusterStopped() {
+	config := KindConfig{
+		nuvolarisClusterName: "nuvolaris",
+		kind: func(...string) error {
+			fmt.Println("nuvolaris")
+			return nil
+		},
+		docker: func(...string) (string, error) {
+			return "nuvolaris-worker\texited\nnuvolaris-control-plane\texited\n", nil
+		},
+	}
+	err := config.manageKindCluster(NewLogger(), "create")
+	fmt.Println(err)
+	// Output:
+	// error in create cluster: kind cluster nuvolaris is stopped, start it with nuv devcluster start
+}
+
 func Example_multipleDevClustersRunningWithNuvolaris() {
 	config := KindConfig{
 		nuvolarisClusterName: "nuvolaris",
@@ -46,6 +66,9 @@ func Example_multipleDevClustersRunningWithNuvolaris() {
 			fmt.Println("nuvolaris")
 			return nil
 		},
+		docker: func(...string) (string, error) {
+			return "nuvolaris-control-plane\trunning\n", nil
+		},
 	}
 	config.manageKindCluster(NewLogger(), "create")
 	// Output:
@@ -59,7 +82,7 @@ func Example_preflightChecksNok() {
 		kind: func(...string) error {
 			return nil
 		},
-		preflightChecks: func(*Logger, string) error {
+		preflightChecks: func(*Logger, string, *kindClusterConfig, bool, bool) error {
 			return fmt.Errorf("docker is not running")
 		},
 	}
@@ -77,7 +100,7 @@ func Example_successfullClusterStartFromScratch() {
 		nuvolarisConfigDir:   ".nuvolaris",
 		kindConfigFile:       "kind.yaml",
 		fullConfigPath:       "",
-		preflightChecks: func(*Logger, string) error {
+		preflightChecks: func(*Logger, string, *kindClusterConfig, bool, bool) error {
 			return nil
 		},
 		kind: func(...string) error {
@@ -105,6 +128,9 @@ func Example_destroyRunningCluster() {
 			fmt.Println("nuvolaris")
 			return nil
 		},
+		docker: func(...string) (string, error) {
+			return "", fmt.Errorf("no such object")
+		},
 	}
 
 	config.manageKindCluster(NewLogger(), "destroy")
@@ -120,6 +146,9 @@ func Example_destroyClusterNotRunning() {
 		kind: func(...string) error {
 			return nil
 		},
+		docker: func(...string) (string, error) {
+			return "", fmt.Errorf("no such object")
+		},
 	}
 
 	config.manageKindCluster(NewLogger(), "destroy")
@@ -0,0 +1,334 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"sigs.k8s.io/yaml"
+)
+
+const devClusterFile = "devcluster.yaml"
+const maxDevClusterWorkers = 10
+const kindNodeImage = "kindest/node"
+
+var kubernetesVersionRegex = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+// devClusterTopology customizes the embedded kind configuration,
+// it is read from ~/.nuvolaris/devcluster.yaml and overridden by the flags
+type devClusterTopology struct {
+	Workers           *int        `json:"workers,omitempty"`
+	Image             string      `json:"image,omitempty"`
+	KubernetesVersion string      `json:"kubernetesVersion,omitempty"`
+	APIServerPort     int         `json:"apiServerPort,omitempty"`
+	Ports             map[int]int `json:"ports,omitempty"`
+	Mounts            []kindMount `json:"mounts,omitempty"`
+	Registry          bool        `json:"registry,omitempty"`
+}
+
+// optionalInt is an int flag that remembers if it was given
+type optionalInt struct {
+	value int
+	set   bool
+}
+
+func (o *optionalInt) Decode(ctx *kong.DecodeContext) error {
+	token, err := ctx.Scan.PopValue("int")
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(fmt.Sprint(token.Value))
+	if err != nil {
+		return fmt.Errorf("expected an int but got %q", token.Value)
+	}
+	o.value, o.set = n, true
+	return nil
+}
+
+func readDevClusterTopology(nuvHomedir string) (devClusterTopology, error) {
+	var topology devClusterTopology
+	path := filepath.Join(nuvHomedir, devClusterFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return topology, nil
+	}
+	if err != nil {
+		return topology, err
+	}
+	if err := yaml.UnmarshalStrict(data, &topology); err != nil {
+		return topology, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return topology, nil
+}
+
+// merge overrides the topology with the values set in other
+func (t devClusterTopology) merge(other devClusterTopology) devClusterTopology {
+	if other.Workers != nil {
+		t.Workers = other.Workers
+	}
+	if other.Image != "" || other.KubernetesVersion != "" {
+		t.Image, t.KubernetesVersion = other.Image, other.KubernetesVersion
+	}
+	if other.APIServerPort != 0 {
+		t.APIServerPort = other.APIServerPort
+	}
+	if len(other.Ports) > 0 {
+		ports := map[int]int{}
+		for from, to := range t.Ports {
+			ports[from] = to
+		}
+		for from, to := range other.Ports {
+			ports[from] = to
+		}
+		t.Ports = ports
+	}
+	t.Mounts = append(append([]kindMount{}, t.Mounts...), other.Mounts...)
+	t.Registry = t.Registry || other.Registry
+	return t
+}
+
+func (t devClusterTopology) validate() error {
+	if t.Workers != nil && (*t.Workers < 0 || *t.Workers > maxDevClusterWorkers) {
+		return fmt.Errorf("workers must be between 0 and %d", maxDevClusterWorkers)
+	}
+	if t.Image != "" && t.KubernetesVersion != "" {
+		return fmt.Errorf("set either the node image or the kubernetes version, not both")
+	}
+	if t.Image != "" && strings.ContainsAny(t.Image, " \t") {
+		return fmt.Errorf("invalid node image %q", t.Image)
+	}
+	if t.KubernetesVersion != "" && !kubernetesVersionRegex.MatchString(t.KubernetesVersion) {
+		return fmt.Errorf("invalid kubernetes version %q, expected something like v1.24.0", t.KubernetesVersion)
+	}
+	if t.APIServerPort != 0 && !validPort(t.APIServerPort) {
+		return fmt.Errorf("invalid api server port %d", t.APIServerPort)
+	}
+	targets := map[int]int{}
+	for _, from := range sortedPorts(t.Ports) {
+		to := t.Ports[from]
+		if !validPort(from) || !validPort(to) {
+			return fmt.Errorf("invalid port remapping %d=%d", from, to)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("ports %d and %d are both remapped to %d", other, from, to)
+		}
+		targets[to] = from
+	}
+	for _, mount := range t.Mounts {
+		if !filepath.IsAbs(mount.HostPath) || !strings.HasPrefix(mount.ContainerPath, "/") {
+			return fmt.Errorf("invalid mount %s:%s, both paths must be absolute", mount.HostPath, mount.ContainerPath)
+		}
+	}
+	return nil
+}
+
+func (t devClusterTopology) image() string {
+	if t.KubernetesVersion != "" {
+		return kindNodeImage + ":v" + strings.TrimPrefix(t.KubernetesVersion, "v")
+	}
+	return t.Image
+}
+
+// apply merges the topology into the kind configuration
+func (t devClusterTopology) apply(cfg *kindClusterConfig) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	if t.APIServerPort != 0 {
+		cfg.Networking.APIServerPort = t.APIServerPort
+	}
+	if t.Workers != nil {
+		cfg.Nodes = resizeWorkers(cfg.Nodes, *t.Workers)
+	}
+	for i := range cfg.Nodes {
+		node := &cfg.Nodes[i]
+		if image := t.image(); image != "" {
+			node.Image = image
+		}
+		for _, mount := range t.Mounts {
+			node.ExtraMounts = addMount(node.ExtraMounts, mount)
+		}
+	}
+
+	for _, from := range sortedPorts(t.Ports) {
+		if !hasHostPort(cfg, from) {
+			return fmt.Errorf("cannot remap port %d: it is not a host port of the devcluster", from)
+		}
+	}
+	remapHostPorts(cfg, t.Ports)
+	if t.Registry {
+		cfg.ContainerdConfigPatches = append(cfg.ContainerdConfigPatches, registryContainerdPatch())
+	}
+	return checkHostPorts(cfg)
+}
+
+// kindHostPorts returns the host ports of the api server and the port mappings
+func kindHostPorts(cfg *kindClusterConfig) []int {
+	ports := []int{}
+	if cfg.Networking.APIServerPort != 0 {
+		ports = append(ports, cfg.Networking.APIServerPort)
+	}
+	for _, node := range cfg.Nodes {
+		for _, mapping := range node.ExtraPortMappings {
+			ports = append(ports, mapping.HostPort)
+		}
+	}
+	return ports
+}
+
+func hasHostPort(cfg *kindClusterConfig, port int) bool {
+	for _, node := range cfg.Nodes {
+		for _, mapping := range node.ExtraPortMappings {
+			if mapping.HostPort == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var apiPortLabelRegex = regexp.MustCompile(`nuvolaris\.io/apiport=(\d+)`)
+
+// remapHostPorts moves the host ports of the kind configuration all at once,
+// so that they can be swapped, updating the apiport label of the nuvolaris api host
+func remapHostPorts(cfg *kindClusterConfig, remap map[int]int) {
+	if to, ok := remap[cfg.Networking.APIServerPort]; ok {
+		cfg.Networking.APIServerPort = to
+	}
+	for i := range cfg.Nodes {
+		node := &cfg.Nodes[i]
+		for j := range node.ExtraPortMappings {
+			if to, ok := remap[node.ExtraPortMappings[j].HostPort]; ok {
+				node.ExtraPortMappings[j].HostPort = to
+			}
+		}
+		for j, patch := range node.KubeadmConfigPatches {
+			node.KubeadmConfigPatches[j] = apiPortLabelRegex.ReplaceAllStringFunc(patch, func(label string) string {
+				from, _ := strconv.Atoi(apiPortLabelRegex.FindStringSubmatch(label)[1])
+				if to, ok := remap[from]; ok {
+					return fmt.Sprintf("nuvolaris.io/apiport=%d", to)
+				}
+				return label
+			})
+		}
+	}
+}
+
+// resizeWorkers keeps the control plane and sets the number of workers;
+// new workers copy the last one without the port mappings, which can be bound once,
+// and without workers the mappings and the mounts move to the control plane
+func resizeWorkers(nodes []kindNodeConfig, workers int) []kindNodeConfig {
+	var controlPlanes, current []kindNodeConfig
+	for _, node := range nodes {
+		if node.Role == "worker" {
+			current = append(current, node)
+		} else {
+			controlPlanes = append(controlPlanes, node)
+		}
+	}
+	if len(current) == 0 || len(controlPlanes) == 0 {
+		return nodes
+	}
+	if workers == 0 {
+		cp := &controlPlanes[0]
+		for _, worker := range current {
+			cp.ExtraPortMappings = append(cp.ExtraPortMappings, worker.ExtraPortMappings...)
+			for _, mount := range worker.ExtraMounts {
+				cp.ExtraMounts = addMount(cp.ExtraMounts, mount)
+			}
+		}
+		return controlPlanes
+	}
+	for len(current) < workers {
+		worker := current[len(current)-1]
+		worker.ExtraPortMappings = nil
+		worker.ExtraMounts = append([]kindMount{}, worker.ExtraMounts...)
+		current = append(current, worker)
+	}
+	return append(controlPlanes, current[:workers]...)
+}
+
+// addMount adds the mount replacing the one with the same container path
+func addMount(mounts []kindMount, mount kindMount) []kindMount {
+	result := []kindMount{}
+	for _, m := range mounts {
+		if m.ContainerPath != mount.ContainerPath {
+			result = append(result, m)
+		}
+	}
+	return append(result, mount)
+}
+
+func checkHostPorts(cfg *kindClusterConfig) error {
+	used := map[int]bool{}
+	if cfg.Networking.APIServerPort != 0 {
+		used[cfg.Networking.APIServerPort] = true
+	}
+	for _, node := range cfg.Nodes {
+		for _, mapping := range node.ExtraPortMappings {
+			if used[mapping.HostPort] {
+				return fmt.Errorf("host port %d is used twice in the devcluster configuration", mapping.HostPort)
+			}
+			used[mapping.HostPort] = true
+		}
+	}
+	return nil
+}
+
+// parseMount parses a host:container[:ro] mount flag from the right,
+// as the host path can be a windows one like C:\src
+func parseMount(s string) (kindMount, error) {
+	invalid := fmt.Errorf("invalid mount %q, expected <host path>:<container path>[:ro]", s)
+	mount := kindMount{}
+	spec := s
+	if strings.HasSuffix(spec, ":ro") || strings.HasSuffix(spec, ":rw") {
+		mount.ReadOnly = strings.HasSuffix(spec, ":ro")
+		spec = spec[:len(spec)-3]
+	}
+	sep := strings.LastIndex(spec, ":")
+	if sep <= 0 || !strings.HasPrefix(spec[sep+1:], "/") {
+		return kindMount{}, invalid
+	}
+	hostPath, err := filepath.Abs(spec[:sep])
+	if err != nil {
+		return kindMount{}, err
+	}
+	mount.HostPath = hostPath
+	mount.ContainerPath = spec[sep+1:]
+	return mount, nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port < 65536
+}
+
+func sortedPorts(ports map[int]int) []int {
+	keys := make([]int, 0, len(ports))
+	for k := range ports {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
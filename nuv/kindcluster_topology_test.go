@@ -0,0 +1,215 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+)
+
+func embeddedKindConfig(t *testing.T) *kindClusterConfig {
+	cfg, err := parseKindConfig(kindYaml)
+	assert.NoError(t, err)
+	return cfg
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func Test_parseKindConfig(t *testing.T) {
+	cfg := embeddedKindConfig(t)
+	assert.Equal(t, "nuvolaris", cfg.Name)
+	assert.Equal(t, 16443, cfg.Networking.APIServerPort)
+	assert.Equal(t, []string{"control-plane", "worker"}, []string{cfg.Nodes[0].Role, cfg.Nodes[1].Role})
+	assert.Equal(t, kindPortMapping{ContainerPort: 30232, HostPort: 3232, Protocol: "TCP"}, cfg.Nodes[1].ExtraPortMappings[0])
+	assert.Equal(t, []kindMount{{HostPath: "$NUV_DATA_DIR", ContainerPath: "/data"}}, cfg.Nodes[1].ExtraMounts)
+}
+
+func Test_applyTopology(t *testing.T) {
+	t.Run("should add workers without port mappings", func(t *testing.T) {
+		cfg := embeddedKindConfig(t)
+		topology := devClusterTopology{
+			Workers:           intPtr(3),
+			KubernetesVersion: "1.23.6",
+			APIServerPort:     26443,
+			Ports:             map[int]int{80: 8080, 443: 8443},
+			Mounts:            []kindMount{{HostPath: "/src", ContainerPath: "/src", ReadOnly: true}},
+		}
+		assert.NoError(t, topology.apply(cfg))
+		assert.Equal(t, 26443, cfg.Networking.APIServerPort)
+		assert.Len(t, cfg.Nodes, 4)
+		for _, node := range cfg.Nodes {
+			assert.Equal(t, "kindest/node:v1.23.6", node.Image)
+			assert.Contains(t, node.ExtraMounts, kindMount{HostPath: "/src", ContainerPath: "/src", ReadOnly: true})
+		}
+		assert.Len(t, cfg.Nodes[1].ExtraPortMappings, 9)
+		assert.Empty(t, cfg.Nodes[2].ExtraPortMappings)
+		assert.Equal(t, cfg.Nodes[1].ExtraMounts, cfg.Nodes[3].ExtraMounts)
+		assert.Equal(t, kindPortMapping{ContainerPort: 80, HostPort: 8080, Protocol: "TCP"}, cfg.Nodes[1].ExtraPortMappings[7])
+		assert.Equal(t, kindPortMapping{ContainerPort: 443, HostPort: 8443, Protocol: "TCP"}, cfg.Nodes[1].ExtraPortMappings[8])
+	})
+
+	t.Run("should move the port mappings to the control plane without workers", func(t *testing.T) {
+		cfg := embeddedKindConfig(t)
+		assert.NoError(t, devClusterTopology{Workers: intPtr(0)}.apply(cfg))
+		assert.Len(t, cfg.Nodes, 1)
+		assert.Equal(t, "control-plane", cfg.Nodes[0].Role)
+		assert.Len(t, cfg.Nodes[0].ExtraPortMappings, 9)
+		assert.Equal(t, []kindMount{{HostPath: "$NUV_DATA_DIR", ContainerPath: "/data"}}, cfg.Nodes[0].ExtraMounts)
+	})
+
+	t.Run("should replace a mount with the same container path", func(t *testing.T) {
+		cfg := embeddedKindConfig(t)
+		assert.NoError(t, devClusterTopology{Mounts: []kindMount{{HostPath: "/big/disk", ContainerPath: "/data"}}}.apply(cfg))
+		assert.Equal(t, []kindMount{{HostPath: "/big/disk", ContainerPath: "/data"}}, cfg.Nodes[1].ExtraMounts)
+	})
+
+	t.Run("should reject unknown and conflicting ports", func(t *testing.T) {
+		assert.ErrorContains(t, devClusterTopology{Ports: map[int]int{8080: 80}}.apply(embeddedKindConfig(t)), "cannot remap port 8080")
+		assert.ErrorContains(t, devClusterTopology{Ports: map[int]int{80: 443}}.apply(embeddedKindConfig(t)), "host port 443 is used twice")
+		assert.ErrorContains(t, devClusterTopology{APIServerPort: 3233}.apply(embeddedKindConfig(t)), "host port 3233 is used twice")
+	})
+}
+
+func Test_validateTopology(t *testing.T) {
+	assert.NoError(t, devClusterTopology{}.validate())
+	assert.ErrorContains(t, devClusterTopology{Workers: intPtr(-1)}.validate(), "workers must be between 0 and 10")
+	assert.ErrorContains(t, devClusterTopology{Image: "kindest/node:v1.24.0", KubernetesVersion: "v1.24.0"}.validate(), "not both")
+	assert.ErrorContains(t, devClusterTopology{KubernetesVersion: "latest"}.validate(), `invalid kubernetes version "latest"`)
+	assert.ErrorContains(t, devClusterTopology{APIServerPort: 70000}.validate(), "invalid api server port")
+	assert.ErrorContains(t, devClusterTopology{Ports: map[int]int{80: 0}}.validate(), "invalid port remapping 80=0")
+	assert.ErrorContains(t, devClusterTopology{Ports: map[int]int{80: 8080, 443: 8080}}.validate(), "ports 80 and 443 are both remapped to 8080")
+	assert.ErrorContains(t, devClusterTopology{Mounts: []kindMount{{HostPath: "src", ContainerPath: "/src"}}}.validate(), "must be absolute")
+}
+
+func Test_parseMount(t *testing.T) {
+	mount, err := parseMount("/src:/src:ro")
+	assert.NoError(t, err)
+	assert.Equal(t, kindMount{HostPath: "/src", ContainerPath: "/src", ReadOnly: true}, mount)
+	mount, err = parseMount("/src:/app:rw")
+	assert.NoError(t, err)
+	assert.Equal(t, kindMount{HostPath: "/src", ContainerPath: "/app"}, mount)
+
+	// the drive letter of a windows path is part of the host path
+	mount, err = parseMount(`C:\src:/src:ro`)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(mount.HostPath, `C:\src`), mount.HostPath)
+	assert.Equal(t, "/src", mount.ContainerPath)
+	assert.True(t, mount.ReadOnly)
+
+	for _, invalid := range []string{"/src", `C:\src`, ":/src", "/src:src", "/src:/src:ro:ro"} {
+		_, err = parseMount(invalid)
+		assert.ErrorContains(t, err, "invalid mount", invalid)
+	}
+}
+
+func Test_readDevClusterTopology(t *testing.T) {
+	dir := t.TempDir()
+	topology, err := readDevClusterTopology(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, devClusterTopology{}, topology)
+
+	content := "workers: 2\nkubernetesVersion: v1.24.0\nports:\n  80: 8080\nmounts:\n- hostPath: /src\n  containerPath: /src\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, devClusterFile), []byte(content), 0600))
+	topology, err = readDevClusterTopology(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, devClusterTopology{
+		Workers:           intPtr(2),
+		KubernetesVersion: "v1.24.0",
+		Ports:             map[int]int{80: 8080},
+		Mounts:            []kindMount{{HostPath: "/src", ContainerPath: "/src"}},
+	}, topology)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, devClusterFile), []byte("worker: 2\n"), 0600))
+	_, err = readDevClusterTopology(dir)
+	assert.ErrorContains(t, err, `unknown field "worker"`)
+}
+
+func Test_devClusterFlags(t *testing.T) {
+	var cli struct {
+		DevCluster DevClusterCmd `cmd:"" name:"devcluster"`
+	}
+	parser, err := kong.New(&cli)
+	assert.NoError(t, err)
+	_, err = parser.Parse([]string{"devcluster", "create", "--workers", "0", "--k8s-version", "v1.24.0",
+		"--port", "80=8080", "--port", "443=8443", "--mount", "/src:/src:ro"})
+	assert.NoError(t, err)
+	flags, err := cli.DevCluster.topology()
+	assert.NoError(t, err)
+
+	file := devClusterTopology{Workers: intPtr(2), Image: "kindest/node:v1.23.6", Ports: map[int]int{80: 9090, 3233: 4233}}
+	assert.Equal(t, devClusterTopology{
+		Workers:           intPtr(0),
+		KubernetesVersion: "v1.24.0",
+		Ports:             map[int]int{80: 8080, 443: 8443, 3233: 4233},
+		Mounts:            []kindMount{{HostPath: "/src", ContainerPath: "/src", ReadOnly: true}},
+	}, file.merge(flags))
+
+	_, err = parser.Parse([]string{"devcluster", "create", "--mount", "/src"})
+	assert.NoError(t, err)
+	_, err = cli.DevCluster.topology()
+	assert.ErrorContains(t, err, `invalid mount "/src"`)
+}
+
+func Example_rewriteKindConfigFileWithTopology() {
+	dir, _ := os.MkdirTemp("", "nuv-topology")
+	defer os.RemoveAll(dir)
+	restore := GetHomeDir
+	GetHomeDir = func() (string, error) { return dir, nil }
+	defer func() { GetHomeDir = restore }()
+
+	config := KindConfig{
+		homedir:        "/home/nuv",
+		kindYaml:       []byte("kind: Cluster\napiVersion: kind.x-k8s.io/v1alpha4\nname: nuvolaris\nnodes:\n- role: control-plane\n- role: worker\n  extraPortMappings:\n  - containerPort: 80\n    hostPort: 80\n  extraMounts:\n  - hostPath: $NUV_DATA_DIR\n    containerPath: /data\n"),
+		kindConfigFile: "kind.yaml",
+		topology:       devClusterTopology{Workers: intPtr(2), Image: "kindest/node:v1.24.0", Ports: map[int]int{80: 8080}},
+	}
+	kindCfg, _ := config.renderKindConfig()
+	path, _ := config.rewriteKindConfigFile(kindCfg)
+	data, _ := os.ReadFile(path)
+	os.Stdout.Write(data)
+	// Output:
+	// nuvolaris config dir created
+	// kind.yaml written
+	// apiVersion: kind.x-k8s.io/v1alpha4
+	// kind: Cluster
+	// name: nuvolaris
+	// networking: {}
+	// nodes:
+	// - image: kindest/node:v1.24.0
+	//   role: control-plane
+	// - extraMounts:
+	//   - containerPath: /data
+	//     hostPath: /home/nuv/.nuvolaris_data
+	//   extraPortMappings:
+	//   - containerPort: 80
+	//     hostPort: 8080
+	//   image: kindest/node:v1.24.0
+	//   role: worker
+	// - extraMounts:
+	//   - containerPath: /data
+	//     hostPath: /home/nuv/.nuvolaris_data
+	//   image: kindest/node:v1.24.0
+	//   role: worker
+}
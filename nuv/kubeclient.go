@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -80,6 +81,36 @@ func initClients(k8sContext string) (*KubeClient, error) {
 	}, nil
 }
 
+// kubeClientForContext connects to the given kubeconfig context
+// without changing the current context
+func kubeClientForContext(k8sContext string) (*KubeClient, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: getKubeconfigPath()},
+		&clientcmd.ConfigOverrides{CurrentContext: k8sContext})
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := assertContext(rawConfig, k8sContext); err != nil {
+		return nil, err
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = 5 * time.Second
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %s", err)
+	}
+	return &KubeClient{
+		clientset: clientset,
+		namespace: NuvolarisNamespace,
+		ctx:       context.Background(),
+		cfg:       restConfig,
+	}, nil
+}
+
 func startDevCluster(logger *Logger) error {
 	fmt.Println("Starting kind devcluster...")
 	cfg, err := configKind()
@@ -37,7 +37,9 @@ type Logger struct {
 	// kind special additions
 	isSmartWriter bool
 
-	spinner       *log.Spinner
+	spinner *log.Spinner
+	// statusMu protects spinnerStatus, read by the progress of concurrent transfers
+	statusMu      sync.Mutex
 	spinnerStatus string
 	// for controlling coloring etc
 	successFormat string
@@ -77,19 +79,20 @@ func (l *Logger) ActionWithSpinner(msg string, f func() bool) {
 func (l *Logger) StartSpinner(msg string) {
 	l.EndSpinner(true)
 	// set new status
-	l.spinnerStatus = msg
+	l.swapSpinnerStatus(msg)
 	if l.spinner != nil {
-		l.spinner.SetSuffix(fmt.Sprintf(" %s ", l.spinnerStatus))
+		l.spinner.SetSuffix(fmt.Sprintf(" %s ", msg))
 		l.spinner.Start()
 	} else {
-		l.Infof(" • %s  ...\n", l.spinnerStatus)
+		l.Infof(" • %s  ...\n", msg)
 	}
 }
 
 // EndSpinner completes the current status, ending any previous spinning and
 // marking the status as success or failure
 func (l *Logger) EndSpinner(success bool) {
-	if l.spinnerStatus == "" {
+	status := l.swapSpinnerStatus("")
+	if status == "" {
 		return
 	}
 
@@ -99,22 +102,44 @@ func (l *Logger) EndSpinner(success bool) {
 		// fmt.Fprint(l.spinner.writer, "\r")
 	}
 	if success {
-		l.Infof(l.successFormat, l.spinnerStatus)
+		l.Infof(l.successFormat, status)
 	} else {
-		l.Infof(l.failureFormat, l.spinnerStatus)
+		l.Infof(l.failureFormat, status)
 	}
+}
 
-	l.spinnerStatus = ""
+// SpinnerProgress shows the progress of the current status, if attached to a terminal;
+// it can be called by concurrent goroutines
+func (l *Logger) SpinnerProgress(msg string) {
+	l.statusMu.Lock()
+	status := l.spinnerStatus
+	l.statusMu.Unlock()
+	if l.spinner == nil || status == "" {
+		return
+	}
+	l.spinner.SetSuffix(fmt.Sprintf(" %s %s ", status, msg))
 }
 
 func (l *Logger) EndSpinnerMsg(success bool, msg string) {
+	l.statusMu.Lock()
 	if l.spinnerStatus == "" {
+		l.statusMu.Unlock()
 		return
 	}
 	l.spinnerStatus = msg
+	l.statusMu.Unlock()
 	l.EndSpinner(success)
 }
 
+// swapSpinnerStatus sets the status, returning the previous one
+func (l *Logger) swapSpinnerStatus(status string) string {
+	l.statusMu.Lock()
+	defer l.statusMu.Unlock()
+	previous := l.spinnerStatus
+	l.spinnerStatus = status
+	return previous
+}
+
 // NewLogger returns the standard logger used by the CLI
 func NewLogger() *Logger {
 	var writer io.Writer = os.Stdout
@@ -0,0 +1,67 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type PackCmd struct {
+	Target         string   `arg:"" help:"Zip file to create." type:"path"`
+	Folder         string   `arg:"" help:"Folder of the multi file action." type:"path"`
+	Exclude        []string `help:"glob patterns of the files to exclude, in .gitignore syntax"`
+	FollowSymlinks bool     `help:"archive the target of symbolic links instead of failing"`
+}
+
+func (p *PackCmd) Run(logger *Logger) error {
+	return packAction(p.Folder, p.Target, p.Exclude, p.FollowSymlinks, logger)
+}
+
+// packAction zips the folder of a multi file action, skipping
+// the zip itself when it is created inside the folder. Unlike bundles
+// it ignores .gitignore, since the action needs its node_modules
+func packAction(folder, target string, exclude []string, followSymlinks bool, logger *Logger) error {
+	if !dirExists(folder) {
+		return fmt.Errorf("folder '%s' not found! Cannot pack the action", folder)
+	}
+	exclude = append([]string{".git/"}, exclude...)
+	if rel, err := filepath.Rel(folder, target); err == nil && !strings.HasPrefix(rel, "..") {
+		exclude = append(exclude, "/"+filepath.ToSlash(rel))
+	}
+	filter, err := newPatternFilter(nil, exclude)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(os.DirFS(folder), filter, followSymlinks)
+	if err != nil {
+		return err
+	}
+
+	a, err := NewArchive(target, followSymlinks, logger)
+	if err != nil {
+		return err
+	}
+	if err := a.AddFiles(folder, files); err != nil {
+		a.Abort()
+		return err
+	}
+	return a.Close()
+}
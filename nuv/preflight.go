@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/alecthomas/units"
@@ -34,6 +35,10 @@ type PreflightChecksPipeline struct {
 	dockerData        string
 	err               error
 	logger            *Logger
+	kindConfig        *kindClusterConfig
+	remapPorts        bool
+	registry          bool
+	portBound         func(int) bool
 }
 
 type checkStep func(pd *PreflightChecksPipeline)
@@ -46,17 +51,21 @@ func (p *PreflightChecksPipeline) step(f checkStep) {
 }
 
 // RunPreflightChecks performs preflight checks
-// checks docker version, available memory and dir paths
-func RunPreflightChecks(logger *Logger, dir string) error {
+// checks docker version, available memory, dir paths and host ports, including
+// the one of the local registry; busy host ports are remapped in the kind config
+// when remapPorts is set
+func RunPreflightChecks(logger *Logger, dir string, kindConfig *kindClusterConfig, remapPorts bool, registry bool) error {
 
 	// Preflight Checks pipeline
 	// TODO: keep skipDockerVersion and dryRun?
-	pp := PreflightChecksPipeline{skipDockerVersion: false, dryRun: false, dir: dir, logger: logger}
+	pp := PreflightChecksPipeline{skipDockerVersion: false, dryRun: false, dir: dir, logger: logger,
+		kindConfig: kindConfig, remapPorts: remapPorts, registry: registry, portBound: isPortBound}
 
 	pp.step(extractDockerInfo)
 	pp.step(checkDockerMemory)
 	pp.step(ensureDockerVersion)
 	pp.step(isInHomePath)
+	pp.step(ensureHostPortsFree)
 
 	return pp.err
 }
@@ -139,3 +148,111 @@ func isInHomePath(p *PreflightChecksPipeline) {
 	}
 	p.logger.EndSpinner(true)
 }
+
+func ensureHostPortsFree(p *PreflightChecksPipeline) {
+	if p.kindConfig == nil {
+		return
+	}
+	p.logger.StartSpinner("Host ports available?")
+	used := map[int]bool{}
+	if p.registry {
+		// the registry port is in the containerd config, it cannot be remapped
+		used[registryPort] = true
+		if p.portBound(registryPort) {
+			if owner := hostPortOwner(p.dryRun, registryPort); owner != "container "+registryName {
+				p.logger.EndSpinner(false)
+				p.err = fmt.Errorf("host port %d of the local registry is in use by %s: free it or create the cluster without --registry", registryPort, owner)
+				return
+			}
+		}
+	}
+	ports := kindHostPorts(p.kindConfig)
+	busy := []int{}
+	for _, port := range ports {
+		used[port] = true
+		if p.portBound(port) {
+			busy = append(busy, port)
+		}
+	}
+	if len(busy) == 0 {
+		p.logger.EndSpinner(true)
+		return
+	}
+	p.logger.EndSpinner(false)
+
+	remap := map[int]int{}
+	for _, port := range busy {
+		free := freeHostPort(port, used, p.portBound)
+		if free == 0 {
+			p.err = fmt.Errorf("host port %d is in use by %s and no free port was found", port, hostPortOwner(p.dryRun, port))
+			return
+		}
+		used[free] = true
+		remap[port] = free
+	}
+
+	if p.remapPorts {
+		for _, port := range busy {
+			p.logger.Infof("host port %d is in use by %s, remapped to %d", port, hostPortOwner(p.dryRun, port), remap[port])
+		}
+		remapHostPorts(p.kindConfig, remap)
+		return
+	}
+
+	var msg strings.Builder
+	var flags []string
+	msg.WriteString("host ports already in use:\n")
+	for _, port := range busy {
+		fmt.Fprintf(&msg, "  %d by %s\n", port, hostPortOwner(p.dryRun, port))
+		if port == p.kindConfig.Networking.APIServerPort {
+			flags = append(flags, fmt.Sprintf("--api-server-port %d", remap[port]))
+		} else {
+			flags = append(flags, fmt.Sprintf("--port %d=%d", port, remap[port]))
+		}
+	}
+	fmt.Fprintf(&msg, "free them, rerun with --remap-ports to use free ports or remap them with %s", strings.Join(flags, " "))
+	p.err = fmt.Errorf("%s", msg.String())
+}
+
+// freeHostPort looks for a free port replacing a busy one:
+// privileged ports move to the 8000 range (80 to 8080), others to the next ports
+func freeHostPort(port int, used map[int]bool, portBound func(int) bool) int {
+	candidate := port + 1
+	if port < 1024 {
+		candidate = port + 8000
+	}
+	for ; candidate < 65536 && candidate < port+9000; candidate++ {
+		if !used[candidate] && !portBound(candidate) {
+			return candidate
+		}
+	}
+	return 0
+}
+
+var dockerPortRegex = regexp.MustCompile(`:(\d+)->`)
+
+// hostPortOwner tells which container or process is listening on the host port
+func hostPortOwner(dryRun bool, port int) string {
+	if out, err := sysErr(dryRun, "@docker ps --format", "{{.Names}}\t{{.Ports}}"); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			name, published, _ := strings.Cut(line, "\t")
+			for _, match := range dockerPortRegex.FindAllStringSubmatch(published, -1) {
+				if match[1] == strconv.Itoa(port) {
+					return "container " + name
+				}
+			}
+		}
+	}
+	if out, err := sysErr(dryRun, "@lsof -nP -sTCP:LISTEN -Fpc", fmt.Sprintf("-iTCP:%d", port)); err == nil {
+		// lsof prints a p<pid> line followed by a c<command> line for each process
+		var pid string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if strings.HasPrefix(line, "p") {
+				pid = line[1:]
+			} else if strings.HasPrefix(line, "c") && pid != "" {
+				return fmt.Sprintf("process %s (pid %s)", line[1:], pid)
+			}
+		}
+	}
+	return "an unknown process"
+}
@@ -67,3 +67,60 @@ func Test_checkDockerMemory(t *testing.T) {
 	p.step(checkDockerMemory)
 	assert.Error(t, p.err)
 }
+
+func Test_ensureHostPortsFree(t *testing.T) {
+	busy := func(ports ...int) func(int) bool {
+		return func(port int) bool {
+			for _, p := range ports {
+				if p == port {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	t.Run("should pass when the ports are free", func(t *testing.T) {
+		p := PreflightChecksPipeline{kindConfig: embeddedKindConfig(t), portBound: busy(), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.NoError(t, p.err)
+	})
+
+	t.Run("should report who holds the ports and suggest free ones", func(t *testing.T) {
+		DryRunPush("web\t0.0.0.0:80->80/tcp", "p42\ncnode\n", "web\t0.0.0.0:80->80/tcp, :::80->80/tcp")
+		p := PreflightChecksPipeline{dryRun: true, kindConfig: embeddedKindConfig(t), portBound: busy(80, 3233, 3234), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.EqualError(t, p.err, "host ports already in use:\n"+
+			"  3233 by process node (pid 42)\n"+
+			"  80 by container web\n"+
+			"free them, rerun with --remap-ports to use free ports or remap them with --port 3233=3235 --port 80=8080")
+	})
+
+	t.Run("should check the port of the local registry", func(t *testing.T) {
+		DryRunPush("other\t127.0.0.1:5001->5000/tcp")
+		p := PreflightChecksPipeline{dryRun: true, registry: true, kindConfig: embeddedKindConfig(t), portBound: busy(5001), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.EqualError(t, p.err, "host port 5001 of the local registry is in use by container other: free it or create the cluster without --registry")
+
+		// the registry of a previous cluster is reused
+		DryRunPush(registryName + "\t127.0.0.1:5001->5000/tcp")
+		p = PreflightChecksPipeline{dryRun: true, registry: true, kindConfig: embeddedKindConfig(t), portBound: busy(5001), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.NoError(t, p.err)
+
+		p = PreflightChecksPipeline{kindConfig: embeddedKindConfig(t), portBound: busy(5001), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.NoError(t, p.err)
+	})
+
+	t.Run("should remap the busy ports", func(t *testing.T) {
+		DryRunPush("", "!lsof not found", "", "!lsof not found")
+		cfg := embeddedKindConfig(t)
+		p := PreflightChecksPipeline{dryRun: true, remapPorts: true, kindConfig: cfg, portBound: busy(16443, 3233), logger: NewLogger()}
+		p.step(ensureHostPortsFree)
+		assert.NoError(t, p.err)
+		assert.Equal(t, 16444, cfg.Networking.APIServerPort)
+		assert.Equal(t, 3234, cfg.Nodes[1].ExtraPortMappings[1].HostPort)
+		assert.Contains(t, cfg.Nodes[0].KubeadmConfigPatches[0], "nuvolaris.io/apiport=3234,")
+	})
+}
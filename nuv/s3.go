@@ -18,25 +18,48 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/alecthomas/kong"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 )
 
-const s3endpoint = "a-dummy-endpoint"
 const secretFile = "secrets.json"
 
+// defaultS3Region is accepted by MinIO and the in-cluster object store
+const defaultS3Region = "us-east-1"
+
+// s3EndpointAnnotation of the cluster configmap holds the url of the in-cluster object store
+const s3EndpointAnnotation = nuvAnnotationPrefix + "s3-endpoint"
+
+// s3Options are the flags of nuv s3 shared by the subcommands
+type s3Options struct {
+	Endpoint string
+	Insecure bool
+	Profile  string
+}
+
 func runS3(f func(s3iface.S3API, string) error, bucket string) error {
-	session, err := newS3session()
+	return runS3With(s3Options{}, f, bucket)
+}
+
+func runS3With(opts s3Options, f func(s3iface.S3API, string) error, bucket string) error {
+	session, err := newS3session(opts)
 	if err != nil {
 		return err
 	}
@@ -44,39 +67,63 @@ func runS3(f func(s3iface.S3API, string) error, bucket string) error {
 }
 
 type S3Cmd struct {
-	Mb      mb      `cmd:"" help:"creates an S3 bucket"`
-	List    ls      `cmd:"" help:"lists S3 objects and common prefixes under a prefix or all S3 buckets"`
-	Put     put     `cmd:"" help:"puts a local file in a S3 bucket"`
-	Secrets secrets `cmd:"" help:"sets secrets for the S3 session"`
+	Endpoint string `help:"url of the S3 endpoint (default: the one saved with the credentials, the cluster one for the credentials of the cluster config, else AWS)"`
+	Insecure bool   `help:"skip the verification of the TLS certificate of the endpoint"`
+	Profile  string `help:"named profile of the S3 secrets to use (default: the AWS env vars, the default secrets, then the cluster config)"`
+
+	Mb      mb        `cmd:"" help:"creates an S3 bucket"`
+	List    ls        `cmd:"" help:"lists S3 objects and common prefixes under a prefix or all S3 buckets"`
+	Put     put       `cmd:"" help:"puts a local file in a S3 bucket"`
+	Get     get       `cmd:"" help:"gets an object from a S3 bucket to a file or the standard output"`
+	Cp      cp        `cmd:"" help:"copies files and objects between the local disk and S3 buckets"`
+	Rm      rm        `cmd:"" help:"removes an object or, with --recursive, all the objects under a prefix"`
+	Rb      rb        `cmd:"" help:"removes an empty S3 bucket, or any bucket with --force"`
+	Sync    s3sync    `cmd:"" help:"uploads the changed files of a folder to a bucket, like rsync"`
+	Uploads uploads   `cmd:"" help:"lists or aborts the incomplete multipart uploads of a bucket"`
+	Presign presign   `cmd:"" help:"prints a temporary url to download or upload an object without credentials"`
+	Bucket  bucketCmd `cmd:"" help:"gets, sets or deletes the CORS, policy, lifecycle and website configuration of a bucket"`
+	Serve   s3serve   `cmd:"" help:"runs a local S3 compatible server, to use nuv s3 and the S3 SDKs without a cluster"`
+	Secrets secrets   `cmd:"" help:"sets secrets for the S3 session"`
 }
 type mb struct {
 	BucketName string `arg:"" type:"string" help:"the name of the bucket to create"`
 }
 
-func (c *mb) Run() error {
-	return runS3(createBucket, c.BucketName)
-}
-
-type ls struct {
-	BucketName string `arg:"" type:"string" help:"the name of the bucket to list"`
+// AfterApply makes the flags available to the subcommands
+func (c *S3Cmd) AfterApply(ctx *kong.Context) error {
+	ctx.Bind(s3Options{Endpoint: c.Endpoint, Insecure: c.Insecure, Profile: c.Profile})
+	return nil
 }
 
-func (c *ls) Run() error {
-	return runS3(listBucketContent, c.BucketName)
+func (c *mb) Run(opts s3Options) error {
+	return runS3With(opts, createBucket, c.BucketName)
 }
 
 type put struct {
-	BucketName string `arg:"" type:"string" help:"the name of the bucket to use"`
-	File       string `arg:"" type:"path" help:"the file to put in the bucket"`
+	BucketName  string `arg:"" type:"string" help:"the name of the bucket to use"`
+	File        string `arg:"" type:"existingfile" help:"the file to put in the bucket"`
+	Key         string `help:"the key of the object (default: the file name as given)"`
+	PartSize    string `default:"8MiB" help:"size of the parts of multipart uploads (min. 5MiB)"`
+	Concurrency int    `default:"4" help:"number of parts uploaded in parallel"`
+	Resume      bool   `help:"resume an interrupted upload of the same file and part size"`
+
+	objectFlags `embed:""`
 }
 
-func (c *put) Run() error {
-	content, err := os.ReadFile(c.File)
+func (c *put) Run(opts s3Options, logger *Logger) error {
+	cfg, err := parseUploadConfig(c.PartSize, c.Concurrency)
 	if err != nil {
 		return err
 	}
-	putFile := preparePut(c.File, string(content))
-	return runS3(putFile, c.BucketName)
+	if err := c.validate(); err != nil {
+		return err
+	}
+	cfg.object = c.objectFlags
+	key := c.Key
+	if key == "" {
+		key = c.File
+	}
+	return runS3With(opts, prepareMultipartUpload(c.File, key, cfg, c.Resume, logger), c.BucketName)
 }
 
 type secrets struct {
@@ -85,104 +132,247 @@ type secrets struct {
 	Region string `arg:"" type:"string" help:"The region to use for the S3 session"`
 }
 
-func (c *secrets) Run() error {
+// Run saves also --endpoint and --insecure, for MinIO or the in-cluster object store,
+// as the default secrets or, with --profile, as a named profile keeping the others
+func (c *secrets) Run(opts s3Options) error {
+	s := s3SecretsJSON{
+		Id:       c.Id,
+		Key:      c.Key,
+		Region:   c.Region,
+		Endpoint: opts.Endpoint,
+		Insecure: opts.Insecure,
+	}
+	return saveS3Secrets(opts.Profile, s)
+}
+
+// saveS3Secrets replaces the default secrets or a profile, keeping the others
+func saveS3Secrets(profile string, s s3SecretsJSON) error {
 	path, err := GetOrCreateNuvolarisConfigDir()
 	if err != nil {
 		return err
 	}
-	s := s3SecretsJSON{
-		Id:     c.Id,
-		Key:    c.Key,
-		Region: c.Region,
+	file, err := readS3SecretsFile(os.DirFS(path))
+	if err != nil {
+		return err
 	}
-	j, err := json.Marshal(s)
+	if profile == "" {
+		file.s3SecretsJSON = s
+	} else {
+		if file.Profiles == nil {
+			file.Profiles = map[string]s3SecretsJSON{}
+		}
+		file.Profiles[profile] = s
+	}
+	j, err := json.Marshal(file)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(filepath.Join(path, secretFile), j, 0600)
 }
 
-func newS3session() (s3iface.S3API, error) {
+func newS3session(opts s3Options) (s3iface.S3API, error) {
 	path, err := GetOrCreateNuvolarisConfigDir()
 	if err != nil {
 		return nil, err
 	}
 	fsys := os.DirFS(path)
-	secrets, err := readS3Secrets(fsys)
+	secrets, err := loadS3Secrets(fsys, opts.Profile)
 	if err != nil {
 		return nil, err
 	}
 
+	secrets, err = resolveS3Endpoint(secrets, opts)
+	if err != nil {
+		return nil, err
+	}
 	conf := buildAwsConfig(secrets)
 	awsSession, err := session.NewSession(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	return s3.New(awsSession, &aws.Config{Endpoint: aws.String(s3endpoint)}), nil
+	return s3.New(awsSession), nil
 }
 
-func createBucket(svc s3iface.S3API, bucketName string) error {
-	fmt.Printf("Creating bucket %q...\n", bucketName)
-	in := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
-	_, err := svc.CreateBucket(in)
+// resolveS3Endpoint takes the endpoint from the flags, else from where the credentials
+// come from: the saved secrets and the AWS env vars fall back to the default of the SDK,
+// the credentials of the cluster go only to the object store of the cluster
+func resolveS3Endpoint(secrets s3SecretsJSON, opts s3Options) (s3SecretsJSON, error) {
+	if opts.Endpoint != "" {
+		secrets.Endpoint = opts.Endpoint
+	}
+	secrets.Insecure = secrets.Insecure || opts.Insecure
+	if secrets.Endpoint != "" || !secrets.fromCluster {
+		return secrets, nil
+	}
+	endpoint, err := clusterS3Endpoint()
 	if err != nil {
-		return err
+		return secrets, fmt.Errorf("cannot find the object store of the cluster for the credentials of config.yaml, please specify the --endpoint: %w", err)
 	}
-	fmt.Printf("Bucket %q created", bucketName)
-	return nil
+	secrets.Endpoint = endpoint
+	return secrets, nil
 }
 
-func listBucketContent(svc s3iface.S3API, bucketName string) error {
-	in := &s3.ListObjectsV2Input{Bucket: aws.String(bucketName)}
-	o, err := svc.ListObjectsV2(in)
+// clusterS3Endpoint reads the endpoint from the annotations of the configmap
+// of the current cluster, without switching context; without a current context
+// there is no cluster to ask
+var clusterS3Endpoint = func() (string, error) {
+	k8sConfig := getK8sConfig()
+	rawConfig, err := k8sConfig.RawConfig()
 	if err != nil {
-		return err
+		return "", err
 	}
-	fmt.Printf("%+v", o)
-	return nil
+	if rawConfig.CurrentContext == "" {
+		return "", fmt.Errorf("no current kubernetes context")
+	}
+	restConfig, err := k8sConfig.ClientConfig()
+	if err != nil {
+		return "", err
+	}
+	restConfig.Timeout = 10 * time.Second
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+	c := &KubeClient{clientset: clientset, namespace: NuvolarisNamespace, ctx: context.Background(), cfg: restConfig}
+	return readS3EndpointAnnotation(c)
 }
 
-func preparePut(fileName, content string) func(s3iface.S3API, string) error {
-	return func(svc s3iface.S3API, bucketName string) error {
-		fmt.Printf("Uploading %q to bucket %q...", fileName, bucketName)
-		in := &s3.PutObjectInput{
-			Body:   strings.NewReader(content),
-			Key:    aws.String(fileName),
-			Bucket: aws.String(bucketName),
-			ACL:    aws.String(s3.BucketCannedACLPublicRead),
-		}
-		_, err := svc.PutObject(in)
-		if err != nil {
-			return err
-		}
-		fmt.Println("File uploaded successfully")
-		return nil
+func readS3EndpointAnnotation(c *KubeClient) (string, error) {
+	cm, err := getConfigmap(c, NuvolarisConfigmapName)
+	if err != nil {
+		return "", err
+	}
+	endpoint := cm.Annotations[s3EndpointAnnotation]
+	if endpoint == "" {
+		return "", fmt.Errorf("annotation %s not found in the cluster config", s3EndpointAnnotation)
+	}
+	return endpoint, nil
+}
+
+func createBucket(svc s3iface.S3API, bucketName string) error {
+	fmt.Printf("Creating bucket %q...\n", bucketName)
+	in := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+	_, err := svc.CreateBucket(in)
+	if err != nil {
+		return s3Error(err, bucketName, "")
 	}
+	fmt.Printf("Bucket %q created\n", bucketName)
+	return nil
 }
 
+// buildAwsConfig uses path-style addressing, since MinIO, s3ninja and
+// the in-cluster object store do not resolve buckets as subdomains
 func buildAwsConfig(s s3SecretsJSON) *aws.Config {
 	conf := aws.NewConfig()
 	conf.WithRegion(s.Region)
-	conf.WithCredentials(credentials.NewStaticCredentials(s.Id, s.Key, ""))
+	conf.WithCredentials(credentials.NewStaticCredentials(s.Id, s.Key, s.Token))
+	if s.Endpoint != "" {
+		conf.WithEndpoint(s.Endpoint)
+	}
+	conf.WithS3ForcePathStyle(true)
+	if s.Insecure {
+		conf.WithHTTPClient(&http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}})
+	}
 	return conf
 }
 
 type s3SecretsJSON struct {
-	Id     string `json:"id"`
-	Key    string `json:"key"`
-	Region string `json:"region"`
+	Id       string `json:"id"`
+	Key      string `json:"key"`
+	Token    string `json:"token,omitempty"`
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+	// fromCluster marks the credentials of the cluster config, never saved
+	fromCluster bool
+}
+
+// s3SecretsFile is secrets.json: the default secrets at the top level,
+// as saved by the previous versions, and the named profiles
+type s3SecretsFile struct {
+	s3SecretsJSON
+	Profiles map[string]s3SecretsJSON `json:"profiles,omitempty"`
 }
 
-func readS3Secrets(fsys fs.FS) (s3SecretsJSON, error) {
+func readS3SecretsFile(fsys fs.FS) (s3SecretsFile, error) {
+	var file s3SecretsFile
 	content, err := fs.ReadFile(fsys, secretFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
 	if err != nil {
-		return s3SecretsJSON{}, fmt.Errorf("unable to read s3 secrets. Did you set them with nuv s3 secrets?")
+		return file, err
 	}
-	var secrets s3SecretsJSON
-	err = json.Unmarshal(content, &secrets)
+	if err := json.Unmarshal(content, &file); err != nil {
+		return file, fmt.Errorf("%s is not valid: %w", secretFile, err)
+	}
+	return file, nil
+}
+
+// loadS3Secrets uses the requested profile or, without one, the first found of
+// the AWS env vars, the default secrets and the credentials of the cluster config
+func loadS3Secrets(fsys fs.FS, profile string) (s3SecretsJSON, error) {
+	file, err := readS3SecretsFile(fsys)
 	if err != nil {
 		return s3SecretsJSON{}, err
 	}
+	var secrets s3SecretsJSON
+	if profile != "" {
+		var ok bool
+		if secrets, ok = file.Profiles[profile]; !ok {
+			return s3SecretsJSON{}, fmt.Errorf("S3 profile %q not found. Did you set it with nuv s3 --profile %s secrets?", profile, profile)
+		}
+	} else if env, ok := s3SecretsFromEnv(); ok {
+		secrets = env
+	} else if file.Id != "" {
+		secrets = file.s3SecretsJSON
+	} else if cluster, ok := readClusterS3Secrets(fsys); ok {
+		secrets = cluster
+	} else {
+		return s3SecretsJSON{}, fmt.Errorf("unable to find s3 secrets. Did you set them with nuv s3 secrets or the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY env vars?")
+	}
+	if secrets.Region == "" {
+		secrets.Region = firstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), defaultS3Region)
+	}
 	return secrets, nil
 }
+
+// s3SecretsFromEnv reads the variables of the AWS command line tools
+func s3SecretsFromEnv() (s3SecretsJSON, bool) {
+	s := s3SecretsJSON{
+		Id:       os.Getenv("AWS_ACCESS_KEY_ID"),
+		Key:      os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Token:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:   firstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		Endpoint: firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+	}
+	return s, s.Id != "" && s.Key != ""
+}
+
+// readClusterS3Secrets takes the credentials generated by nuv setup in config.yaml,
+// the endpoint comes from the cluster
+func readClusterS3Secrets(fsys fs.FS) (s3SecretsJSON, bool) {
+	content, err := fs.ReadFile(fsys, "config.yaml")
+	if err != nil {
+		return s3SecretsJSON{}, false
+	}
+	var spec WhiskSpec
+	if err := yaml.Unmarshal(content, &spec); err != nil {
+		return s3SecretsJSON{}, false
+	}
+	s := s3SecretsJSON{Id: spec.S3.Id, Key: spec.S3.Key, Region: spec.S3.Region, fromCluster: true}
+	return s, s.Id != "" && s.Key != ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
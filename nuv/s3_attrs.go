@@ -0,0 +1,118 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// objectFlags are the attributes of the objects uploaded by put, cp and sync
+type objectFlags struct {
+	ACL             string            `default:"private" enum:"private,public-read,public-read-write,authenticated-read,aws-exec-read,bucket-owner-read,bucket-owner-full-control" help:"canned ACL of the uploaded objects"`
+	CacheControl    string            `help:"Cache-Control header of the uploaded objects"`
+	ContentEncoding string            `help:"Content-Encoding header of the uploaded objects, such as gzip for precompressed files"`
+	Metadata        map[string]string `help:"user metadata of the uploaded objects, as key=value"`
+}
+
+var metadataKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// validate checks the metadata keys, that travel as x-amz-meta-<key> headers
+func (o objectFlags) validate() error {
+	for k := range o.Metadata {
+		if !metadataKey.MatchString(k) {
+			return fmt.Errorf("invalid metadata key '%s': use letters, digits and -", k)
+		}
+	}
+	return nil
+}
+
+func (o objectFlags) metadata() map[string]*string {
+	if len(o.Metadata) == 0 {
+		return nil
+	}
+	return aws.StringMap(o.Metadata)
+}
+
+func (o objectFlags) putInput(in *s3.PutObjectInput) {
+	in.ACL = aws.String(o.acl())
+	in.CacheControl = optionalString(o.CacheControl)
+	in.ContentEncoding = optionalString(o.ContentEncoding)
+	in.Metadata = o.metadata()
+}
+
+func (o objectFlags) uploadInput(in *s3manager.UploadInput) {
+	in.ACL = aws.String(o.acl())
+	in.CacheControl = optionalString(o.CacheControl)
+	in.ContentEncoding = optionalString(o.ContentEncoding)
+	in.Metadata = o.metadata()
+}
+
+// copyInput keeps the headers of the source unless some are given: then
+// they are all replaced, preserving the content type of the source
+func (o objectFlags) copyInput(svc s3iface.S3API, in *s3.CopyObjectInput, srcBucket, srcKey string) error {
+	in.ACL = aws.String(o.acl())
+	if o.CacheControl == "" && o.ContentEncoding == "" && len(o.Metadata) == 0 {
+		return nil
+	}
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(srcBucket), Key: aws.String(srcKey)})
+	if err != nil {
+		return err
+	}
+	in.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	in.ContentType = head.ContentType
+	in.CacheControl = optionalString(o.CacheControl)
+	in.ContentEncoding = optionalString(o.ContentEncoding)
+	in.Metadata = o.metadata()
+	return nil
+}
+
+// acl defaults to private also when the flags are not parsed, as in the tests
+func (o objectFlags) acl() string {
+	if o.ACL == "" {
+		return s3.ObjectCannedACLPrivate
+	}
+	return o.ACL
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// sniffContentType detects the type from the name and the head
+// of the content, rewinding it for the upload
+func sniffContentType(name string, f io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return contentTypeOf(name, head[:n]), nil
+}
@@ -0,0 +1,75 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_objectFlags(t *testing.T) {
+	var cli struct {
+		S3 S3Cmd `cmd:"" name:"s3"`
+	}
+	parser, err := kong.New(&cli)
+	assert.NoError(t, err)
+
+	_, err = parser.Parse([]string{"s3", "put", "some-bucket", "s3_attrs.go"})
+	assert.NoError(t, err)
+	assert.Equal(t, "private", cli.S3.Put.ACL)
+
+	_, err = parser.Parse([]string{"s3", "sync", ".", "some-bucket", "--acl", "public-read",
+		"--cache-control", "max-age=3600", "--content-encoding", "gzip", "--metadata", "owner=web", "--metadata", "build=42"})
+	assert.NoError(t, err)
+	object := cli.S3.Sync.objectFlags
+	assert.NoError(t, object.validate())
+
+	in := &s3.PutObjectInput{}
+	object.putInput(in)
+	assert.Equal(t, &s3.PutObjectInput{
+		ACL:             aws.String("public-read"),
+		CacheControl:    aws.String("max-age=3600"),
+		ContentEncoding: aws.String("gzip"),
+		Metadata:        map[string]*string{"owner": aws.String("web"), "build": aws.String("42")},
+	}, in)
+
+	_, err = parser.Parse([]string{"s3", "cp", "a.txt", "s3://b/", "--acl", "everyone"})
+	assert.ErrorContains(t, err, "--acl must be one of")
+
+	assert.EqualError(t, objectFlags{Metadata: map[string]string{"a b": "c"}}.validate(), "invalid metadata key 'a b': use letters, digits and -")
+}
+
+func Test_sniffContentType(t *testing.T) {
+	f := bytes.NewReader([]byte("%PDF-1.4 document"))
+	ctype, err := sniffContentType("report", f)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", ctype)
+	rest, _ := io.ReadAll(f)
+	assert.Equal(t, "%PDF-1.4 document", string(rest))
+
+	ctype, err = sniffContentType("style.css", strings.NewReader("body {}"))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/css; charset=utf-8", ctype)
+}
@@ -0,0 +1,456 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"sigs.k8s.io/yaml"
+)
+
+// bucketCmd configures buckets with the documents of the AWS command line,
+// as in aws s3api put-bucket-cors --cors-configuration, in JSON or YAML
+type bucketCmd struct {
+	Cors      bucketConfigCmd `cmd:"" help:"CORS rules, to call the bucket from web applications of other origins"`
+	Policy    bucketConfigCmd `cmd:"" help:"access policy, for example to make a bucket public"`
+	Lifecycle bucketConfigCmd `cmd:"" help:"lifecycle rules, to expire objects and incomplete uploads"`
+	Website   bucketConfigCmd `cmd:"" help:"static website hosting: index, error document and redirects"`
+}
+
+type bucketConfigCmd struct {
+	Get    bucketConfigGet    `cmd:"" help:"prints the configuration of the bucket"`
+	Set    bucketConfigSet    `cmd:"" help:"replaces the configuration of the bucket with the one in a JSON or YAML file"`
+	Delete bucketConfigDelete `cmd:"" help:"removes the configuration of the bucket"`
+}
+
+type bucketConfigGet struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket"`
+}
+
+type bucketConfigSet struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket"`
+	File       string `arg:"" type:"existingfile" help:"the JSON or YAML file with the configuration"`
+}
+
+type bucketConfigDelete struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket"`
+}
+
+// selectedBucketConfig is the kind of configuration, from the parent of the command
+func selectedBucketConfig(ctx *kong.Context) bucketConfigKind {
+	return bucketConfigs[ctx.Selected().Parent.Name]
+}
+
+func (c *bucketConfigGet) Run(opts s3Options, ctx *kong.Context) error {
+	return runS3With(opts, prepareBucketConfigGet(selectedBucketConfig(ctx), os.Stdout), c.BucketName)
+}
+
+func (c *bucketConfigSet) Run(opts s3Options, ctx *kong.Context) error {
+	doc, err := os.ReadFile(c.File)
+	if err != nil {
+		return err
+	}
+	kind := selectedBucketConfig(ctx)
+	// check the document before connecting
+	if _, err := kind.parse(doc); err != nil {
+		return fmt.Errorf("%s: %w", c.File, err)
+	}
+	return runS3With(opts, prepareBucketConfigSet(kind, doc), c.BucketName)
+}
+
+func (c *bucketConfigDelete) Run(opts s3Options, ctx *kong.Context) error {
+	return runS3With(opts, prepareBucketConfigDelete(selectedBucketConfig(ctx)), c.BucketName)
+}
+
+// bucketConfigKind wraps the S3 calls of one kind of bucket configuration
+type bucketConfigKind struct {
+	name string
+	// missing is the error code of a bucket without the configuration
+	missing string
+	parse   func(doc []byte) (any, error)
+	get     func(svc s3iface.S3API, bucket string) (any, error)
+	put     func(svc s3iface.S3API, bucket string, config any) error
+	delete  func(svc s3iface.S3API, bucket string) error
+}
+
+var bucketConfigs = map[string]bucketConfigKind{
+	"cors": {
+		name:    "CORS",
+		missing: "NoSuchCORSConfiguration",
+		parse:   func(doc []byte) (any, error) { return parseCors(doc) },
+		get: func(svc s3iface.S3API, bucket string) (any, error) {
+			out, err := svc.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(bucket)})
+			if err != nil {
+				return nil, err
+			}
+			return &s3.CORSConfiguration{CORSRules: out.CORSRules}, nil
+		},
+		put: func(svc s3iface.S3API, bucket string, config any) error {
+			_, err := svc.PutBucketCors(&s3.PutBucketCorsInput{Bucket: aws.String(bucket), CORSConfiguration: config.(*s3.CORSConfiguration)})
+			return err
+		},
+		delete: func(svc s3iface.S3API, bucket string) error {
+			_, err := svc.DeleteBucketCors(&s3.DeleteBucketCorsInput{Bucket: aws.String(bucket)})
+			return err
+		},
+	},
+	"policy": {
+		name:    "policy",
+		missing: "NoSuchBucketPolicy",
+		parse:   func(doc []byte) (any, error) { return parsePolicy(doc) },
+		get: func(svc s3iface.S3API, bucket string) (any, error) {
+			out, err := svc.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+			if err != nil {
+				return nil, err
+			}
+			return json.RawMessage(aws.StringValue(out.Policy)), nil
+		},
+		put: func(svc s3iface.S3API, bucket string, config any) error {
+			_, err := svc.PutBucketPolicy(&s3.PutBucketPolicyInput{Bucket: aws.String(bucket), Policy: aws.String(config.(string))})
+			return err
+		},
+		delete: func(svc s3iface.S3API, bucket string) error {
+			_, err := svc.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)})
+			return err
+		},
+	},
+	"lifecycle": {
+		name:    "lifecycle",
+		missing: "NoSuchLifecycleConfiguration",
+		parse:   func(doc []byte) (any, error) { return parseLifecycle(doc) },
+		get: func(svc s3iface.S3API, bucket string) (any, error) {
+			out, err := svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+			if err != nil {
+				return nil, err
+			}
+			return &s3.BucketLifecycleConfiguration{Rules: out.Rules}, nil
+		},
+		put: func(svc s3iface.S3API, bucket string, config any) error {
+			_, err := svc.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+				Bucket:                 aws.String(bucket),
+				LifecycleConfiguration: config.(*s3.BucketLifecycleConfiguration),
+			})
+			return err
+		},
+		delete: func(svc s3iface.S3API, bucket string) error {
+			_, err := svc.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)})
+			return err
+		},
+	},
+	"website": {
+		name:    "website",
+		missing: "NoSuchWebsiteConfiguration",
+		parse:   func(doc []byte) (any, error) { return parseWebsite(doc) },
+		get: func(svc s3iface.S3API, bucket string) (any, error) {
+			out, err := svc.GetBucketWebsite(&s3.GetBucketWebsiteInput{Bucket: aws.String(bucket)})
+			if err != nil {
+				return nil, err
+			}
+			return &s3.WebsiteConfiguration{
+				ErrorDocument:         out.ErrorDocument,
+				IndexDocument:         out.IndexDocument,
+				RedirectAllRequestsTo: out.RedirectAllRequestsTo,
+				RoutingRules:          out.RoutingRules,
+			}, nil
+		},
+		put: func(svc s3iface.S3API, bucket string, config any) error {
+			_, err := svc.PutBucketWebsite(&s3.PutBucketWebsiteInput{Bucket: aws.String(bucket), WebsiteConfiguration: config.(*s3.WebsiteConfiguration)})
+			return err
+		},
+		delete: func(svc s3iface.S3API, bucket string) error {
+			_, err := svc.DeleteBucketWebsite(&s3.DeleteBucketWebsiteInput{Bucket: aws.String(bucket)})
+			return err
+		},
+	},
+}
+
+func prepareBucketConfigGet(kind bucketConfigKind, out io.Writer) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		config, err := kind.get(svc, bucketName)
+		if err != nil {
+			return bucketConfigError(kind, err, bucketName)
+		}
+		return printBucketConfig(out, config)
+	}
+}
+
+func prepareBucketConfigSet(kind bucketConfigKind, doc []byte) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		config, err := kind.parse(doc)
+		if err != nil {
+			return err
+		}
+		if err := kind.put(svc, bucketName, config); err != nil {
+			return bucketConfigError(kind, err, bucketName)
+		}
+		fmt.Printf("Bucket %q %s configuration set\n", bucketName, kind.name)
+		return nil
+	}
+}
+
+func prepareBucketConfigDelete(kind bucketConfigKind) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		if err := kind.delete(svc, bucketName); err != nil {
+			return bucketConfigError(kind, err, bucketName)
+		}
+		fmt.Printf("Bucket %q %s configuration deleted\n", bucketName, kind.name)
+		return nil
+	}
+}
+
+func bucketConfigError(kind bucketConfigKind, err error, bucket string) error {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == kind.missing {
+		return fmt.Errorf("bucket %q has no %s configuration", bucket, kind.name)
+	}
+	return s3Error(err, bucket, "")
+}
+
+// printBucketConfig prints the configuration as JSON, without the unset
+// fields, so that it can be edited and set again
+func printBucketConfig(out io.Writer, config any) error {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var tree any
+	if err := json.Unmarshal(content, &tree); err != nil {
+		return err
+	}
+	content, err = json.MarshalIndent(dropNulls(tree), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(content))
+	return err
+}
+
+func dropNulls(tree any) any {
+	switch v := tree.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if child == nil {
+				delete(v, k)
+			} else {
+				v[k] = dropNulls(child)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = dropNulls(child)
+		}
+	}
+	return tree
+}
+
+// decodeBucketConfig reads JSON or YAML, rejecting unknown fields to catch typos
+func decodeBucketConfig(doc []byte, v any) error {
+	content, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// validator is implemented by the inputs of the AWS SDK, checking the required fields
+type validator interface {
+	Validate() error
+}
+
+var corsMethods = map[string]bool{"GET": true, "PUT": true, "POST": true, "DELETE": true, "HEAD": true}
+
+func parseCors(doc []byte) (*s3.CORSConfiguration, error) {
+	var config s3.CORSConfiguration
+	if err := decodeBucketConfig(doc, &config); err != nil {
+		return nil, err
+	}
+	if err := validateInput(&s3.PutBucketCorsInput{Bucket: aws.String("bucket"), CORSConfiguration: &config}); err != nil {
+		return nil, err
+	}
+	if len(config.CORSRules) > 100 {
+		return nil, fmt.Errorf("at most 100 CORSRules are allowed")
+	}
+	for i, rule := range config.CORSRules {
+		if len(rule.AllowedOrigins) == 0 {
+			return nil, fmt.Errorf("CORSRules[%d]: AllowedOrigins is empty", i)
+		}
+		for _, method := range rule.AllowedMethods {
+			if !corsMethods[aws.StringValue(method)] {
+				return nil, fmt.Errorf("CORSRules[%d]: invalid method '%s', use GET, PUT, POST, DELETE or HEAD", i, aws.StringValue(method))
+			}
+		}
+		if aws.Int64Value(rule.MaxAgeSeconds) < 0 {
+			return nil, fmt.Errorf("CORSRules[%d]: MaxAgeSeconds cannot be negative", i)
+		}
+	}
+	return &config, nil
+}
+
+// bucketPolicy has the fields checked before sending the policy, kept as it is
+type bucketPolicy struct {
+	Version   string          `json:"Version"`
+	Statement json.RawMessage `json:"Statement"`
+}
+
+type policyStatement struct {
+	Effect      string `json:"Effect"`
+	Action      any    `json:"Action"`
+	NotAction   any    `json:"NotAction"`
+	Resource    any    `json:"Resource"`
+	NotResource any    `json:"NotResource"`
+}
+
+func parsePolicy(doc []byte) (string, error) {
+	content, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return "", err
+	}
+	var policy bucketPolicy
+	if err := json.Unmarshal(content, &policy); err != nil {
+		return "", err
+	}
+	if policy.Version != "" && policy.Version != "2012-10-17" && policy.Version != "2008-10-17" {
+		return "", fmt.Errorf("invalid Version '%s', use 2012-10-17", policy.Version)
+	}
+	// a single statement can be given without the list
+	var statements []policyStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var single policyStatement
+		if err := json.Unmarshal(policy.Statement, &single); err != nil {
+			return "", fmt.Errorf("Statement must be a statement or a list of statements")
+		}
+		statements = []policyStatement{single}
+	}
+	if len(statements) == 0 {
+		return "", fmt.Errorf("the policy has no Statement")
+	}
+	for i, st := range statements {
+		if st.Effect != "Allow" && st.Effect != "Deny" {
+			return "", fmt.Errorf("Statement[%d]: Effect must be Allow or Deny", i)
+		}
+		if st.Action == nil && st.NotAction == nil {
+			return "", fmt.Errorf("Statement[%d]: Action is missing", i)
+		}
+		if st.Resource == nil && st.NotResource == nil {
+			return "", fmt.Errorf("Statement[%d]: Resource is missing", i)
+		}
+	}
+	return string(content), nil
+}
+
+func parseLifecycle(doc []byte) (*s3.BucketLifecycleConfiguration, error) {
+	var config s3.BucketLifecycleConfiguration
+	if err := decodeBucketConfig(doc, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Rules) > 1000 {
+		return nil, fmt.Errorf("at most 1000 Rules are allowed")
+	}
+	ids := map[string]bool{}
+	for i, rule := range config.Rules {
+		id := aws.StringValue(rule.ID)
+		if len(id) > 255 {
+			return nil, fmt.Errorf("Rules[%d]: ID is longer than 255 characters", i)
+		}
+		if id != "" && ids[id] {
+			return nil, fmt.Errorf("Rules[%d]: duplicate ID '%s'", i, id)
+		}
+		ids[id] = true
+		status := aws.StringValue(rule.Status)
+		if status != s3.ExpirationStatusEnabled && status != s3.ExpirationStatusDisabled {
+			return nil, fmt.Errorf("Rules[%d]: Status must be Enabled or Disabled", i)
+		}
+		if rule.Expiration == nil && len(rule.Transitions) == 0 && rule.NoncurrentVersionExpiration == nil &&
+			len(rule.NoncurrentVersionTransitions) == 0 && rule.AbortIncompleteMultipartUpload == nil {
+			return nil, fmt.Errorf("Rules[%d]: no action, add Expiration, Transitions or AbortIncompleteMultipartUpload", i)
+		}
+		// without a filter the rule applies to the whole bucket
+		if rule.Filter == nil && rule.Prefix == nil {
+			rule.Filter = &s3.LifecycleRuleFilter{Prefix: aws.String("")}
+		}
+	}
+	if err := validateInput(&s3.PutBucketLifecycleConfigurationInput{Bucket: aws.String("bucket"), LifecycleConfiguration: &config}); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func parseWebsite(doc []byte) (*s3.WebsiteConfiguration, error) {
+	var config s3.WebsiteConfiguration
+	if err := decodeBucketConfig(doc, &config); err != nil {
+		return nil, err
+	}
+	if err := validateInput(&s3.PutBucketWebsiteInput{Bucket: aws.String("bucket"), WebsiteConfiguration: &config}); err != nil {
+		return nil, err
+	}
+	if config.RedirectAllRequestsTo != nil {
+		if config.IndexDocument != nil || config.ErrorDocument != nil || len(config.RoutingRules) > 0 {
+			return nil, fmt.Errorf("RedirectAllRequestsTo cannot be used with the other fields")
+		}
+		return &config, nil
+	}
+	if config.IndexDocument == nil {
+		return nil, fmt.Errorf("IndexDocument or RedirectAllRequestsTo is required")
+	}
+	suffix := aws.StringValue(config.IndexDocument.Suffix)
+	if suffix == "" || strings.Contains(suffix, "/") {
+		return nil, fmt.Errorf("IndexDocument.Suffix must be a file name, such as index.html")
+	}
+	return &config, nil
+}
+
+// validateInput reports the missing required fields, without the
+// request details of the SDK message
+func validateInput(in validator) error {
+	err := in.Validate()
+	var errs request.ErrInvalidParams
+	if !errors.As(err, &errs) {
+		return err
+	}
+	msgs := []string{}
+	for _, e := range errs.OrigErrs() {
+		var param request.ErrInvalidParam
+		if errors.As(e, &param) {
+			// the fields are relative to the document, not to the request:
+			// PutBucketCorsInput.CORSConfiguration.CORSRules[0] becomes CORSRules[0]
+			field := param.Field()
+			for i := 0; i < 2; i++ {
+				if _, rest, ok := strings.Cut(field, "."); ok {
+					field = rest
+				}
+			}
+			msg, _, _ := strings.Cut(param.Message(), ", ")
+			msgs = append(msgs, field+": "+msg)
+		}
+	}
+	return errors.New(strings.Join(msgs, ", "))
+}
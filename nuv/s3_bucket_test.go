@@ -0,0 +1,177 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_selectedBucketConfig(t *testing.T) {
+	var cli struct {
+		S3 S3Cmd `cmd:"" name:"s3"`
+	}
+	parser, err := kong.New(&cli)
+	assert.NoError(t, err)
+	ctx, err := parser.Parse([]string{"s3", "bucket", "lifecycle", "delete", "some-bucket"})
+	assert.NoError(t, err)
+	assert.Equal(t, "lifecycle", selectedBucketConfig(ctx).name)
+}
+
+func Test_parseCors(t *testing.T) {
+	config, err := parseCors([]byte(`
+CORSRules:
+- AllowedOrigins: ["https://app.example.com"]
+  AllowedMethods: [GET, PUT]
+  AllowedHeaders: ["*"]
+  MaxAgeSeconds: 3000
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []*string{aws.String("GET"), aws.String("PUT")}, config.CORSRules[0].AllowedMethods)
+
+	_, err = parseCors([]byte(`{"CORSRules": [{"AllowedOrigins": ["*"], "AllowedMethods": ["PATCH"]}]}`))
+	assert.EqualError(t, err, "CORSRules[0]: invalid method 'PATCH', use GET, PUT, POST, DELETE or HEAD")
+	_, err = parseCors([]byte(`{"CORSRules": [{"AllowedOrigins": ["*"]}]}`))
+	assert.EqualError(t, err, "CORSRules[0].AllowedMethods: missing required field")
+	_, err = parseCors([]byte(`{"CORSRules": [{"AllowedOrigin": ["*"], "AllowedMethods": ["GET"]}]}`))
+	assert.ErrorContains(t, err, `unknown field "AllowedOrigin"`)
+}
+
+func Test_parsePolicy(t *testing.T) {
+	policy, err := parsePolicy([]byte(`
+Version: "2012-10-17"
+Statement:
+  Effect: Allow
+  Principal: "*"
+  Action: s3:GetObject
+  Resource: arn:aws:s3:::web/*
+`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::web/*"}}`, policy)
+
+	_, err = parsePolicy([]byte(`{"Statement": [{"Effect": "allow", "Action": "s3:*", "Resource": "*"}]}`))
+	assert.EqualError(t, err, "Statement[0]: Effect must be Allow or Deny")
+	_, err = parsePolicy([]byte(`{"Statement": [{"Effect": "Deny", "Action": "s3:*"}]}`))
+	assert.EqualError(t, err, "Statement[0]: Resource is missing")
+	_, err = parsePolicy([]byte(`{"Version": "2022-01-01", "Statement": []}`))
+	assert.EqualError(t, err, "invalid Version '2022-01-01', use 2012-10-17")
+	_, err = parsePolicy([]byte(`{"Statement": []}`))
+	assert.EqualError(t, err, "the policy has no Statement")
+}
+
+func Test_parseLifecycle(t *testing.T) {
+	config, err := parseLifecycle([]byte(`
+Rules:
+- ID: tmp
+  Status: Enabled
+  Filter: {Prefix: tmp/}
+  Expiration: {Days: 7}
+- ID: uploads
+  Status: Enabled
+  AbortIncompleteMultipartUpload: {DaysAfterInitiation: 1}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "tmp/", aws.StringValue(config.Rules[0].Filter.Prefix))
+	assert.Equal(t, "", aws.StringValue(config.Rules[1].Filter.Prefix))
+
+	_, err = parseLifecycle([]byte(`{"Rules": [{"ID": "a", "Status": "On", "Expiration": {"Days": 1}}]}`))
+	assert.EqualError(t, err, "Rules[0]: Status must be Enabled or Disabled")
+	_, err = parseLifecycle([]byte(`{"Rules": [{"ID": "a", "Status": "Enabled"}]}`))
+	assert.EqualError(t, err, "Rules[0]: no action, add Expiration, Transitions or AbortIncompleteMultipartUpload")
+	_, err = parseLifecycle([]byte(`{"Rules": [{"ID": "a", "Status": "Enabled", "Expiration": {"Days": 1}}, {"ID": "a", "Status": "Enabled", "Expiration": {"Days": 2}}]}`))
+	assert.EqualError(t, err, "Rules[1]: duplicate ID 'a'")
+}
+
+func Test_parseWebsite(t *testing.T) {
+	config, err := parseWebsite([]byte(`{"IndexDocument": {"Suffix": "index.html"}, "ErrorDocument": {"Key": "404.html"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "404.html", aws.StringValue(config.ErrorDocument.Key))
+
+	_, err = parseWebsite([]byte(`{"RedirectAllRequestsTo": {"HostName": "example.com"}}`))
+	assert.NoError(t, err)
+	_, err = parseWebsite([]byte(`{"ErrorDocument": {"Key": "404.html"}}`))
+	assert.EqualError(t, err, "IndexDocument or RedirectAllRequestsTo is required")
+	_, err = parseWebsite([]byte(`{"IndexDocument": {"Suffix": "app/index.html"}}`))
+	assert.EqualError(t, err, "IndexDocument.Suffix must be a file name, such as index.html")
+	_, err = parseWebsite([]byte(`{"RoutingRules": [{"Condition": {"KeyPrefixEquals": "docs/"}}], "IndexDocument": {"Suffix": "index.html"}}`))
+	assert.EqualError(t, err, "RoutingRules[0].Redirect: missing required field")
+}
+
+func Test_prepareBucketConfig(t *testing.T) {
+	t.Run("should send the parsed configuration", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("PutBucketWebsite", mock.Anything).Return(&s3.PutBucketWebsiteOutput{}, nil)
+		err := prepareBucketConfigSet(bucketConfigs["website"], []byte("IndexDocument: {Suffix: index.html}"))(mockSvc, "web")
+		assert.NoError(t, err)
+		mockSvc.AssertCalled(t, "PutBucketWebsite", &s3.PutBucketWebsiteInput{
+			Bucket:               aws.String("web"),
+			WebsiteConfiguration: &s3.WebsiteConfiguration{IndexDocument: &s3.IndexDocument{Suffix: aws.String("index.html")}},
+		})
+	})
+
+	t.Run("should explain a missing configuration", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("GetBucketCors", mock.Anything).Return(&s3.GetBucketCorsOutput{}, awserr.New("NoSuchCORSConfiguration", "", nil))
+		err := prepareBucketConfigGet(bucketConfigs["cors"], os.Stdout)(mockSvc, "web")
+		assert.EqualError(t, err, `bucket "web" has no CORS configuration`)
+	})
+
+	t.Run("should delete the configuration", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("DeleteBucketPolicy", mock.Anything).Return(&s3.DeleteBucketPolicyOutput{}, nil)
+		assert.NoError(t, prepareBucketConfigDelete(bucketConfigs["policy"])(mockSvc, "web"))
+		mockSvc.AssertCalled(t, "DeleteBucketPolicy", &s3.DeleteBucketPolicyInput{Bucket: aws.String("web")})
+	})
+}
+
+func Example_prepareBucketConfigGet() {
+	mockSvc := new(mockS3Client)
+	mockSvc.On("GetBucketCors", mock.Anything).Return(&s3.GetBucketCorsOutput{CORSRules: []*s3.CORSRule{{
+		AllowedMethods: aws.StringSlice([]string{"GET"}),
+		AllowedOrigins: aws.StringSlice([]string{"*"}),
+	}}}, nil)
+	mockSvc.On("GetBucketPolicy", mock.Anything).Return(&s3.GetBucketPolicyOutput{
+		Policy: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+	}, nil)
+	prepareBucketConfigGet(bucketConfigs["cors"], os.Stdout)(mockSvc, "web")
+	prepareBucketConfigGet(bucketConfigs["policy"], os.Stdout)(mockSvc, "web")
+	// Output:
+	// {
+	//   "CORSRules": [
+	//     {
+	//       "AllowedMethods": [
+	//         "GET"
+	//       ],
+	//       "AllowedOrigins": [
+	//         "*"
+	//       ]
+	//     }
+	//   ]
+	// }
+	// {
+	//   "Statement": [],
+	//   "Version": "2012-10-17"
+	// }
+}
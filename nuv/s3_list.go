@@ -0,0 +1,177 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const listTimeFormat = "2006-01-02 15:04:05"
+
+type ls struct {
+	BucketName string `arg:"" optional:"" type:"string" help:"the name of the bucket to list (default: list the buckets)"`
+	Prefix     string `help:"list only the keys starting with the prefix"`
+	Delimiter  string `help:"group the keys up to the delimiter as folders (default: /)"`
+	Recursive  bool   `short:"r" help:"list all the keys, without grouping them in folders"`
+	Output     string `short:"o" enum:"table,json" default:"table" help:"output format: table or json (one object per line)"`
+}
+
+func (c *ls) Run(opts s3Options) error {
+	if c.BucketName == "" {
+		return runS3With(opts, func(svc s3iface.S3API, _ string) error {
+			return listBuckets(svc, os.Stdout, c.Output)
+		}, "")
+	}
+	if c.Recursive && c.Delimiter != "" {
+		return fmt.Errorf("--recursive lists all the keys, it cannot be used with --delimiter")
+	}
+	delimiter := c.Delimiter
+	if delimiter == "" && !c.Recursive {
+		delimiter = "/"
+	}
+	return runS3With(opts, prepareList(c.Prefix, delimiter, c.Output), c.BucketName)
+}
+
+// listEntry is an object or, with Prefix set, a folder of the listing
+type listEntry struct {
+	Key      string     `json:"key,omitempty"`
+	Prefix   string     `json:"prefix,omitempty"`
+	Size     int64      `json:"size,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+	ETag     string     `json:"etag,omitempty"`
+}
+
+func prepareList(prefix, delimiter, output string) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		return listBucketContent(svc, bucketName, prefix, delimiter, os.Stdout, output)
+	}
+}
+
+// listBucketContent goes through all the pages of the listing, printing them as they arrive
+func listBucketContent(svc s3iface.S3API, bucketName, prefix, delimiter string, out io.Writer, output string) error {
+	in := &s3.ListObjectsV2Input{Bucket: aws.String(bucketName)}
+	if prefix != "" {
+		in.Prefix = aws.String(prefix)
+	}
+	if delimiter != "" {
+		in.Delimiter = aws.String(delimiter)
+	}
+	w := newListWriter(out, output)
+	var writeErr error
+	err := svc.ListObjectsV2Pages(in, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, p := range page.CommonPrefixes {
+			if writeErr = w.write(listEntry{Prefix: aws.StringValue(p.Prefix)}); writeErr != nil {
+				return false
+			}
+		}
+		for _, obj := range page.Contents {
+			entry := listEntry{
+				Key:      aws.StringValue(obj.Key),
+				Size:     aws.Int64Value(obj.Size),
+				Modified: obj.LastModified,
+				ETag:     strings.Trim(aws.StringValue(obj.ETag), `"`),
+			}
+			if writeErr = w.write(entry); writeErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return s3Error(err, bucketName, prefix)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return w.flush()
+}
+
+// listWriter prints aligned columns for people or JSON lines for scripts
+type listWriter struct {
+	table *tabwriter.Writer
+	json  *json.Encoder
+}
+
+func newListWriter(out io.Writer, output string) *listWriter {
+	if output == "json" {
+		return &listWriter{json: json.NewEncoder(out)}
+	}
+	return &listWriter{table: tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)}
+}
+
+func (w *listWriter) write(entry listEntry) error {
+	if w.json != nil {
+		return w.json.Encode(entry)
+	}
+	if entry.Prefix != "" {
+		_, err := fmt.Fprintf(w.table, "\tPRE\t%s\n", entry.Prefix)
+		return err
+	}
+	_, err := fmt.Fprintf(w.table, "%s\t%s\t%s\n", aws.TimeValue(entry.Modified).Format(listTimeFormat), humanSize(entry.Size), entry.Key)
+	return err
+}
+
+func (w *listWriter) flush() error {
+	if w.table != nil {
+		return w.table.Flush()
+	}
+	return nil
+}
+
+func listBuckets(svc s3iface.S3API, out io.Writer, output string) error {
+	res, err := svc.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return s3Error(err, "", "")
+	}
+	enc := json.NewEncoder(out)
+	for _, b := range res.Buckets {
+		if output == "json" {
+			err = enc.Encode(map[string]any{"name": aws.StringValue(b.Name), "created": aws.TimeValue(b.CreationDate)})
+		} else {
+			_, err = fmt.Fprintf(out, "%s  %s\n", aws.TimeValue(b.CreationDate).Format(listTimeFormat), aws.StringValue(b.Name))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// humanSize shows sizes with binary units and one decimal
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,108 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var listModified = time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func listPages() []*s3.ListObjectsV2Output {
+	return []*s3.ListObjectsV2Output{
+		{CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String("site/css/")}}},
+		{Contents: []*s3.Object{
+			{Key: aws.String("site/index.html"), Size: aws.Int64(512), LastModified: aws.Time(listModified), ETag: aws.String(`"a01618fc"`)},
+			{Key: aws.String("site/video.mp4"), Size: aws.Int64(7 * 1024 * 1024), LastModified: aws.Time(listModified), ETag: aws.String(`"b2c3"`)},
+		}},
+	}
+}
+
+func Test_listBucketContent(t *testing.T) {
+	t.Run("should return an error if the listing fails", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{}, errors.New("failed"))
+		err := listBucketContent(mockSvc, "some-bucket", "", "/", os.Stdout, "table")
+		mockSvc.AssertCalled(t, "ListObjectsV2Pages", &s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), Delimiter: aws.String("/")})
+		assert.EqualError(t, err, "failed")
+	})
+
+	t.Run("should pass prefix and no delimiter when recursive", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{}, nil)
+		err := listBucketContent(mockSvc, "some-bucket", "site/", "", os.Stdout, "table")
+		mockSvc.AssertCalled(t, "ListObjectsV2Pages", &s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), Prefix: aws.String("site/")})
+		assert.NoError(t, err)
+	})
+}
+
+func Test_lsFlags(t *testing.T) {
+	c := ls{BucketName: "some-bucket", Recursive: true, Delimiter: "-"}
+	assert.EqualError(t, c.Run(s3Options{}), "--recursive lists all the keys, it cannot be used with --delimiter")
+}
+
+func Test_humanSize(t *testing.T) {
+	assert.Equal(t, "0 B", humanSize(0))
+	assert.Equal(t, "1023 B", humanSize(1023))
+	assert.Equal(t, "1.5 KiB", humanSize(1536))
+	assert.Equal(t, "7.0 MiB", humanSize(7*1024*1024))
+	assert.Equal(t, "2.0 GiB", humanSize(2<<30))
+}
+
+func Example_listBucketContent() {
+	mockSvc := new(mockS3Client)
+	mockSvc.On("ListObjectsV2Pages", mock.Anything).Return(listPages(), nil)
+	listBucketContent(mockSvc, "some-bucket", "site/", "/", os.Stdout, "table")
+	// Output:
+	//                      PRE      site/css/
+	// 2022-05-01 10:00:00  512 B    site/index.html
+	// 2022-05-01 10:00:00  7.0 MiB  site/video.mp4
+}
+
+func Example_listBucketContent_json() {
+	mockSvc := new(mockS3Client)
+	mockSvc.On("ListObjectsV2Pages", mock.Anything).Return(listPages(), nil)
+	listBucketContent(mockSvc, "some-bucket", "site/", "/", os.Stdout, "json")
+	// Output:
+	// {"prefix":"site/css/"}
+	// {"key":"site/index.html","size":512,"modified":"2022-05-01T10:00:00Z","etag":"a01618fc"}
+	// {"key":"site/video.mp4","size":7340032,"modified":"2022-05-01T10:00:00Z","etag":"b2c3"}
+}
+
+func Example_listBuckets() {
+	mockSvc := new(mockS3Client)
+	mockSvc.On("ListBuckets", mock.Anything).Return(&s3.ListBucketsOutput{Buckets: []*s3.Bucket{
+		{Name: aws.String("assets"), CreationDate: aws.Time(listModified)},
+		{Name: aws.String("backups"), CreationDate: aws.Time(listModified)},
+	}}, nil)
+	listBuckets(mockSvc, os.Stdout, "table")
+	listBuckets(mockSvc, os.Stdout, "json")
+	// Output:
+	// 2022-05-01 10:00:00  assets
+	// 2022-05-01 10:00:00  backups
+	// {"created":"2022-05-01T10:00:00Z","name":"assets"}
+	// {"created":"2022-05-01T10:00:00Z","name":"backups"}
+}
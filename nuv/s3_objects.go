@@ -0,0 +1,339 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// s3URLPrefix marks the remote side of nuv s3 cp
+const s3URLPrefix = "s3://"
+
+// deleteBatchSize is the maximum number of keys of a DeleteObjects request
+const deleteBatchSize = 1000
+
+type get struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket to use"`
+	Key        string `arg:"" type:"string" help:"the key of the object to download"`
+	Target     string `arg:"" optional:"" type:"string" help:"the file to write, - for the standard output (default: the last part of the key)"`
+}
+
+func (c *get) Run(opts s3Options) error {
+	target := c.Target
+	if target == "" {
+		target = path.Base(c.Key)
+	}
+	return runS3With(opts, prepareGet(c.Key, target), c.BucketName)
+}
+
+type rm struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket to use"`
+	Key        string `arg:"" optional:"" type:"string" help:"the key of the object to remove, or the prefix with --recursive"`
+	Recursive  bool   `short:"r" help:"remove all the objects under the prefix"`
+}
+
+func (c *rm) Run(opts s3Options) error {
+	if c.Recursive {
+		return runS3With(opts, prepareRemovePrefix(c.Key), c.BucketName)
+	}
+	if c.Key == "" {
+		return fmt.Errorf("missing the key of the object to remove, use --recursive to remove a prefix")
+	}
+	return runS3With(opts, prepareRemove(c.Key), c.BucketName)
+}
+
+type rb struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket to remove"`
+	Force      bool   `help:"remove all the objects of the bucket before removing it"`
+}
+
+func (c *rb) Run(opts s3Options) error {
+	return runS3With(opts, prepareRemoveBucket(c.Force), c.BucketName)
+}
+
+type cp struct {
+	Source string `arg:"" type:"string" help:"a local file or s3://bucket/key"`
+	Target string `arg:"" type:"string" help:"a local file or s3://bucket/key, a trailing / keeps the name of the source"`
+
+	objectFlags `embed:""`
+}
+
+func (c *cp) Run(opts s3Options) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	f, bucket, err := prepareCopy(c.Source, c.Target, c.objectFlags)
+	if err != nil {
+		return err
+	}
+	return runS3With(opts, f, bucket)
+}
+
+func prepareGet(key, target string) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		out, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+		if err != nil {
+			return s3Error(err, bucketName, key)
+		}
+		defer out.Body.Close()
+		if target == "-" {
+			_, err = io.Copy(os.Stdout, out.Body)
+			return err
+		}
+		if err := writeStream(target, out.Body); err != nil {
+			return err
+		}
+		fmt.Printf("Downloaded %q from bucket %q to %s\n", key, bucketName, target)
+		return nil
+	}
+}
+
+// writeStream creates the file only when the download succeeds
+func writeStream(target string, body io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".nuv-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func prepareRemove(key string) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		// deleting a missing key succeeds in S3, so check it first
+		_, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+		if err != nil {
+			return s3Error(err, bucketName, key)
+		}
+		_, err = svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+		if err != nil {
+			return s3Error(err, bucketName, key)
+		}
+		fmt.Printf("Removed %q from bucket %q\n", key, bucketName)
+		return nil
+	}
+}
+
+func prepareRemovePrefix(prefix string) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		count, err := removePrefix(svc, bucketName, prefix)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d objects under %q from bucket %q\n", count, prefix, bucketName)
+		return nil
+	}
+}
+
+// removePrefix deletes the objects under the prefix in batches,
+// returning the number of removed objects
+func removePrefix(svc s3iface.S3API, bucketName, prefix string) (int, error) {
+	count := 0
+	var deleteErr error
+	in := &s3.ListObjectsV2Input{Bucket: aws.String(bucketName), Prefix: aws.String(prefix)}
+	err := svc.ListObjectsV2Pages(in, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for start := 0; start < len(page.Contents); start += deleteBatchSize {
+			end := start + deleteBatchSize
+			if end > len(page.Contents) {
+				end = len(page.Contents)
+			}
+			ids := make([]*s3.ObjectIdentifier, 0, end-start)
+			for _, obj := range page.Contents[start:end] {
+				ids = append(ids, &s3.ObjectIdentifier{Key: obj.Key})
+			}
+			out, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: aws.String(bucketName),
+				Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				deleteErr = s3Error(err, bucketName, prefix)
+				return false
+			}
+			if len(out.Errors) > 0 {
+				e := out.Errors[0]
+				deleteErr = fmt.Errorf("cannot remove %q: %s", aws.StringValue(e.Key), aws.StringValue(e.Message))
+				return false
+			}
+			count += len(ids)
+		}
+		return true
+	})
+	if err != nil {
+		return count, s3Error(err, bucketName, prefix)
+	}
+	return count, deleteErr
+}
+
+func prepareRemoveBucket(force bool) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		if force {
+			if _, err := removePrefix(svc, bucketName, ""); err != nil {
+				return err
+			}
+		}
+		_, err := svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
+		if err != nil {
+			return s3Error(err, bucketName, "")
+		}
+		fmt.Printf("Bucket %q removed\n", bucketName)
+		return nil
+	}
+}
+
+// prepareCopy chooses the transfer from the s3:// prefixes,
+// returning the function to run and the bucket to run it on
+func prepareCopy(source, target string, object objectFlags) (func(s3iface.S3API, string) error, string, error) {
+	srcBucket, srcKey, srcRemote, err := parseS3URL(source)
+	if err != nil {
+		return nil, "", err
+	}
+	dstBucket, dstKey, dstRemote, err := parseS3URL(target)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case srcRemote && dstRemote:
+		dstKey = targetName(dstKey, srcKey)
+		return prepareRemoteCopy(srcBucket, srcKey, dstKey, object), dstBucket, nil
+	case srcRemote:
+		if strings.HasSuffix(target, "/") || dirExists(target) {
+			target = filepath.Join(target, path.Base(srcKey))
+		}
+		return prepareGet(srcKey, target), srcBucket, nil
+	case dstRemote:
+		if !fileExists(source) {
+			return nil, "", fmt.Errorf("file '%s' not found", source)
+		}
+		dstKey = targetName(dstKey, filepath.Base(source))
+		return prepareUpload(source, dstKey, object), dstBucket, nil
+	}
+	return nil, "", fmt.Errorf("either the source or the target must be s3://bucket/key")
+}
+
+// targetName appends the name of the source when the key is a folder
+func targetName(key, source string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key + path.Base(source)
+	}
+	return key
+}
+
+func parseS3URL(arg string) (string, string, bool, error) {
+	if !strings.HasPrefix(arg, s3URLPrefix) {
+		return "", "", false, nil
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(arg, s3URLPrefix), "/")
+	if bucket == "" {
+		return "", "", true, fmt.Errorf("'%s' has no bucket", arg)
+	}
+	return bucket, key, true, nil
+}
+
+// prepareUpload streams the file to the bucket
+func prepareUpload(fileName, key string, object objectFlags) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ctype, err := sniffContentType(fileName, f)
+		if err != nil {
+			return err
+		}
+		in := &s3.PutObjectInput{
+			Body:        f,
+			Key:         aws.String(key),
+			Bucket:      aws.String(bucketName),
+			ContentType: aws.String(ctype),
+		}
+		object.putInput(in)
+		_, err = svc.PutObject(in)
+		if err != nil {
+			return s3Error(err, bucketName, key)
+		}
+		fmt.Printf("Uploaded %s to %s%s/%s\n", fileName, s3URLPrefix, bucketName, key)
+		return nil
+	}
+}
+
+func prepareRemoteCopy(srcBucket, srcKey, key string, object objectFlags) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		in := &s3.CopyObjectInput{
+			Bucket:     aws.String(bucketName),
+			Key:        aws.String(key),
+			CopySource: aws.String(url.PathEscape(srcBucket) + "/" + escapeKey(srcKey)),
+		}
+		if err := object.copyInput(svc, in, srcBucket, srcKey); err != nil {
+			return s3Error(err, srcBucket, srcKey)
+		}
+		_, err := svc.CopyObject(in)
+		if err != nil {
+			return s3Error(err, srcBucket, srcKey)
+		}
+		fmt.Printf("Copied %s%s/%s to %s%s/%s\n", s3URLPrefix, srcBucket, srcKey, s3URLPrefix, bucketName, key)
+		return nil
+	}
+}
+
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// s3Error explains the errors of the S3 API, so every command
+// fails with the same message for the same problem
+func s3Error(err error, bucket, key string) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchBucket:
+		return fmt.Errorf("bucket %q not found", bucket)
+	case s3.ErrCodeNoSuchKey, "NotFound":
+		return fmt.Errorf("object %q not found in bucket %q", key, bucket)
+	case "BucketNotEmpty":
+		return fmt.Errorf("bucket %q is not empty, use --force to remove its objects", bucket)
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return fmt.Errorf("access denied to bucket %q: check nuv s3 secrets (%s)", bucket, aerr.Code())
+	}
+	return fmt.Errorf("%s: %s", aerr.Code(), aerr.Message())
+}
@@ -0,0 +1,196 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func objectsPage(keys ...string) *s3.ListObjectsV2Output {
+	page := &s3.ListObjectsV2Output{}
+	for _, k := range keys {
+		page.Contents = append(page.Contents, &s3.Object{Key: aws.String(k)})
+	}
+	return page
+}
+
+func Test_prepareGet(t *testing.T) {
+	t.Run("should write the object to the target file", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("hello"))}, nil)
+		target := filepath.Join(t.TempDir(), "hello.txt")
+		assert.NoError(t, prepareGet("dir/hello.txt", target)(mockSvc, "some-bucket"))
+		mockSvc.AssertCalled(t, "GetObject", &s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("dir/hello.txt")})
+		content, _ := os.ReadFile(target)
+		assert.Equal(t, "hello", string(content))
+	})
+
+	t.Run("should explain a missing key without creating the file", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{}, awserr.New(s3.ErrCodeNoSuchKey, "missing", nil))
+		target := filepath.Join(t.TempDir(), "hello.txt")
+		err := prepareGet("hello.txt", target)(mockSvc, "some-bucket")
+		assert.EqualError(t, err, `object "hello.txt" not found in bucket "some-bucket"`)
+		assert.False(t, fileExists(target))
+	})
+}
+
+func Test_prepareRemove(t *testing.T) {
+	t.Run("should fail on a missing key", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{}, awserr.New("NotFound", "not found", nil))
+		err := prepareRemove("hello.txt")(mockSvc, "some-bucket")
+		assert.EqualError(t, err, `object "hello.txt" not found in bucket "some-bucket"`)
+		mockSvc.AssertNotCalled(t, "DeleteObject", mock.Anything)
+	})
+
+	t.Run("should remove the prefix in batches", func(t *testing.T) {
+		keys := []string{}
+		for i := 0; i < deleteBatchSize+1; i++ {
+			keys = append(keys, fmt.Sprintf("logs/%d", i))
+		}
+		mockSvc := new(mockS3Client)
+		mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{objectsPage(keys...)}, nil)
+		mockSvc.On("DeleteObjects", mock.Anything).Return(&s3.DeleteObjectsOutput{}, nil)
+		count, err := removePrefix(mockSvc, "some-bucket", "logs/")
+		assert.NoError(t, err)
+		assert.Equal(t, deleteBatchSize+1, count)
+		mockSvc.AssertCalled(t, "ListObjectsV2Pages", &s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), Prefix: aws.String("logs/")})
+		mockSvc.AssertNumberOfCalls(t, "DeleteObjects", 2)
+	})
+
+	t.Run("should return the first error of a batch", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{objectsPage("a"), objectsPage("b")}, nil)
+		mockSvc.On("DeleteObjects", mock.Anything).Return(&s3.DeleteObjectsOutput{
+			Errors: []*s3.Error{{Key: aws.String("a"), Message: aws.String("locked")}},
+		}, nil)
+		_, err := removePrefix(mockSvc, "some-bucket", "")
+		assert.EqualError(t, err, `cannot remove "a": locked`)
+		mockSvc.AssertNumberOfCalls(t, "DeleteObjects", 1)
+	})
+}
+
+func Test_prepareRemoveBucket(t *testing.T) {
+	t.Run("should explain a bucket not empty", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("DeleteBucket", mock.Anything).Return(&s3.DeleteBucketOutput{}, awserr.New("BucketNotEmpty", "not empty", nil))
+		err := prepareRemoveBucket(false)(mockSvc, "some-bucket")
+		assert.ErrorContains(t, err, "--force")
+		mockSvc.AssertNotCalled(t, "ListObjectsV2Pages", mock.Anything)
+	})
+
+	t.Run("should empty the bucket with force", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{objectsPage("a")}, nil)
+		mockSvc.On("DeleteObjects", mock.Anything).Return(&s3.DeleteObjectsOutput{}, nil)
+		mockSvc.On("DeleteBucket", mock.Anything).Return(&s3.DeleteBucketOutput{}, nil)
+		assert.NoError(t, prepareRemoveBucket(true)(mockSvc, "some-bucket"))
+		mockSvc.AssertCalled(t, "DeleteBucket", &s3.DeleteBucketInput{Bucket: aws.String("some-bucket")})
+	})
+}
+
+func Test_prepareCopy(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "hello.txt")
+	os.WriteFile(local, []byte("hello"), 0644)
+
+	t.Run("should upload a local file keeping its name in a folder", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		f, bucket, err := prepareCopy(local, "s3://some-bucket/docs/", objectFlags{})
+		assert.NoError(t, err)
+		assert.Equal(t, "some-bucket", bucket)
+		assert.NoError(t, f(mockSvc, bucket))
+		mockSvc.AssertCalled(t, "PutObject", mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+			return *in.Bucket == "some-bucket" && *in.Key == "docs/hello.txt" &&
+				*in.ACL == "private" && *in.ContentType == "text/plain; charset=utf-8"
+		}))
+	})
+
+	t.Run("should download to a local folder", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("remote"))}, nil)
+		target := t.TempDir()
+		f, bucket, err := prepareCopy("s3://some-bucket/docs/remote.txt", target, objectFlags{})
+		assert.NoError(t, err)
+		assert.NoError(t, f(mockSvc, bucket))
+		content, _ := os.ReadFile(filepath.Join(target, "remote.txt"))
+		assert.Equal(t, "remote", string(content))
+	})
+
+	t.Run("should copy between buckets", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("CopyObject", mock.Anything).Return(&s3.CopyObjectOutput{}, nil)
+		f, bucket, err := prepareCopy("s3://from/a b.txt", "s3://to", objectFlags{})
+		assert.NoError(t, err)
+		assert.Equal(t, "to", bucket)
+		assert.NoError(t, f(mockSvc, bucket))
+		mockSvc.AssertCalled(t, "CopyObject", &s3.CopyObjectInput{
+			Bucket:     aws.String("to"),
+			Key:        aws.String("a b.txt"),
+			CopySource: aws.String("from/a%20b.txt"),
+			ACL:        aws.String("private"),
+		})
+	})
+
+	t.Run("should replace the headers of a copy keeping the content type", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("text/plain")}, nil)
+		mockSvc.On("CopyObject", mock.Anything).Return(&s3.CopyObjectOutput{}, nil)
+		object := objectFlags{ACL: "public-read", CacheControl: "max-age=60"}
+		f, bucket, err := prepareCopy("s3://from/a.txt", "s3://to/", object)
+		assert.NoError(t, err)
+		assert.NoError(t, f(mockSvc, bucket))
+		mockSvc.AssertCalled(t, "CopyObject", &s3.CopyObjectInput{
+			Bucket:            aws.String("to"),
+			Key:               aws.String("a.txt"),
+			CopySource:        aws.String("from/a.txt"),
+			ACL:               aws.String("public-read"),
+			MetadataDirective: aws.String("REPLACE"),
+			ContentType:       aws.String("text/plain"),
+			CacheControl:      aws.String("max-age=60"),
+		})
+	})
+
+	t.Run("should reject local to local and missing files", func(t *testing.T) {
+		_, _, err := prepareCopy(local, local, objectFlags{})
+		assert.ErrorContains(t, err, "s3://bucket/key")
+		_, _, err = prepareCopy(filepath.Join(dir, "missing"), "s3://to/", objectFlags{})
+		assert.ErrorContains(t, err, "not found")
+		_, _, err = prepareCopy(local, "s3:///key", objectFlags{})
+		assert.ErrorContains(t, err, "has no bucket")
+	})
+}
+
+func Test_s3Error(t *testing.T) {
+	assert.EqualError(t, s3Error(awserr.New(s3.ErrCodeNoSuchBucket, "", nil), "b", ""), `bucket "b" not found`)
+	assert.EqualError(t, s3Error(errors.New("network"), "b", ""), "network")
+}
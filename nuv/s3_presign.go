@@ -0,0 +1,79 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// maxPresignExpiry is the longest validity allowed by the V4 signature
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+type presign struct {
+	Object      string        `arg:"" help:"the object to share, as <bucket>/<key> or s3://<bucket>/<key>"`
+	Method      string        `enum:"GET,PUT" default:"GET" help:"GET to download the object, PUT to upload it"`
+	Expires     time.Duration `default:"15m" help:"how long the url is valid (max 168h)"`
+	ContentType string        `help:"content type the upload must be sent with (PUT only)"`
+}
+
+func (c *presign) Run(opts s3Options) error {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(c.Object, s3URLPrefix), "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("'%s' is not a <bucket>/<key> object", c.Object)
+	}
+	if c.Expires <= 0 || c.Expires > maxPresignExpiry {
+		return fmt.Errorf("--expires must be between 1s and %s", maxPresignExpiry)
+	}
+	if c.ContentType != "" && c.Method != "PUT" {
+		return fmt.Errorf("--content-type can be used only with --method PUT")
+	}
+	return runS3With(opts, preparePresign(key, c.Method, c.Expires, c.ContentType, os.Stdout), bucket)
+}
+
+// preparePresign prints a url that allows anyone to download or upload
+// the object until it expires, without credentials
+func preparePresign(key, method string, expires time.Duration, contentType string, out io.Writer) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		var req *request.Request
+		if method == "PUT" {
+			in := &s3.PutObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)}
+			// the type becomes a signed header, so the upload must use the same one
+			if contentType != "" {
+				in.ContentType = aws.String(contentType)
+			}
+			req, _ = svc.PutObjectRequest(in)
+		} else {
+			req, _ = svc.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)})
+		}
+		url, err := req.Presign(expires)
+		if err != nil {
+			return s3Error(err, bucketName, key)
+		}
+		_, err = fmt.Fprintln(out, url)
+		return err
+	}
+}
@@ -0,0 +1,61 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_preparePresign(t *testing.T) {
+	presigned := func(method, contentType string) *url.URL {
+		var out bytes.Buffer
+		err := preparePresign("docs/a b.txt", method, 15*time.Minute, contentType, &out)(new(mockS3Client), "some-bucket")
+		assert.NoError(t, err)
+		u, err := url.Parse(strings.TrimSpace(out.String()))
+		assert.NoError(t, err)
+		return u
+	}
+
+	t.Run("should sign a download url", func(t *testing.T) {
+		u := presigned("GET", "")
+		assert.Equal(t, "/some-bucket/docs/a b.txt", u.Path)
+		assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+		assert.Equal(t, "host", u.Query().Get("X-Amz-SignedHeaders"))
+		assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+	})
+
+	t.Run("should sign the content type of an upload", func(t *testing.T) {
+		u := presigned("PUT", "image/png")
+		assert.Equal(t, "content-type;host", u.Query().Get("X-Amz-SignedHeaders"))
+	})
+}
+
+func Test_presignFlags(t *testing.T) {
+	c := presign{Object: "some-bucket", Method: "GET", Expires: time.Minute}
+	assert.EqualError(t, c.Run(s3Options{}), "'some-bucket' is not a <bucket>/<key> object")
+	c = presign{Object: "some-bucket/key", Method: "GET", Expires: 8 * 24 * time.Hour}
+	assert.EqualError(t, c.Run(s3Options{}), "--expires must be between 1s and 168h0m0s")
+	c = presign{Object: "s3://some-bucket/key", Method: "GET", Expires: time.Minute, ContentType: "text/plain"}
+	assert.EqualError(t, c.Run(s3Options{}), "--content-type can be used only with --method PUT")
+}
@@ -0,0 +1,655 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localS3Profile is the profile of nuv s3 secrets saved by nuv s3 serve
+const localS3Profile = "local"
+
+const s3XMLNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type s3serve struct {
+	Address string `default:"127.0.0.1" help:"address to listen on, 0.0.0.0 to reach it from the containers"`
+	Port    int    `default:"9000" help:"port to listen on"`
+	Dir     string `type:"path" help:"folder of the buckets (default: ~/.nuvolaris/s3)"`
+}
+
+// Run saves the credentials as a profile, local unless --profile is given,
+// reusing the ones of a previous run
+func (c *s3serve) Run(opts s3Options) error {
+	dir := c.Dir
+	if dir == "" {
+		home, err := GetOrCreateNuvolarisConfigDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(home, "s3")
+	}
+	store, err := newS3Store(dir)
+	if err != nil {
+		return err
+	}
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = localS3Profile
+	}
+	endpoint := "http://" + net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+	if c.Address == "0.0.0.0" {
+		endpoint = "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(c.Port))
+	}
+	secrets, err := localS3Secrets(profile, endpoint)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(c.Address, strconv.Itoa(c.Port)))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving S3 buckets from %s on %s\n", dir, endpoint)
+	fmt.Printf("Credentials saved as the profile %q, use: nuv s3 --profile %s list\n", profile, profile)
+	fmt.Printf("or: export AWS_ACCESS_KEY_ID=%s AWS_SECRET_ACCESS_KEY=%s AWS_ENDPOINT_URL=%s\n", secrets.Id, secrets.Key, endpoint)
+	return http.Serve(listener, newS3Server(store, secrets.Id, secrets.Key))
+}
+
+// localS3Secrets reads the profile of the stand-in, generating it the first time
+func localS3Secrets(profile, endpoint string) (s3SecretsJSON, error) {
+	path, err := GetOrCreateNuvolarisConfigDir()
+	if err != nil {
+		return s3SecretsJSON{}, err
+	}
+	file, err := readS3SecretsFile(os.DirFS(path))
+	if err != nil {
+		return s3SecretsJSON{}, err
+	}
+	secrets := file.Profiles[profile]
+	if secrets.Id == "" || secrets.Key == "" {
+		secrets.Id = generateAwsAccessKeyId()
+		secrets.Key = generateAwsSecretAccessKey()
+	}
+	secrets.Region = defaultS3Region
+	secrets.Endpoint = endpoint
+	secrets.Insecure = false
+	return secrets, saveS3Secrets(profile, secrets)
+}
+
+// s3ServeError is an error answered with the XML body of S3
+type s3ServeError struct {
+	XMLName xml.Name `xml:"Error"`
+	Status  int      `xml:"-"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func (e *s3ServeError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func s3ServeErr(status int, code, message string) error {
+	return &s3ServeError{Status: status, Code: code, Message: message}
+}
+
+// s3Server answers the path-style requests of the S3 API used by
+// the nuv s3 commands and the SDKs: buckets, objects and multipart uploads
+type s3Server struct {
+	store     *s3Store
+	accessKey string
+	secretKey string
+	now       func() time.Time
+}
+
+func newS3Server(store *s3Store, accessKey, secretKey string) *s3Server {
+	return &s3Server{store: store, accessKey: accessKey, secretKey: secretKey, now: time.Now}
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// browsers upload with presigned urls from other origins
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, DELETE, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+			w.Header().Set("Access-Control-Max-Age", "3600")
+			return
+		}
+	}
+	if err := verifySigV4(r, s.accessKey, s.secretKey, s.now()); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	var err error
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		err = s.listBuckets(w)
+	case bucket == "":
+		err = s3ServeErr(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	case key == "":
+		err = s.serveBucket(w, r, bucket)
+	default:
+		err = s.serveObject(w, r, bucket, key)
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+	}
+}
+
+func (s *s3Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var serr *s3ServeError
+	if !errors.As(err, &serr) {
+		serr = &s3ServeError{Status: http.StatusInternalServerError, Code: "InternalError", Message: err.Error()}
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(serr.Status)
+		return
+	}
+	writeXML(w, serr.Status, serr)
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	content, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, err = w.Write(append([]byte(xml.Header), content...))
+	return err
+}
+
+func readXML(r *http.Request, v any) error {
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 10<<20)).Decode(v); err != nil {
+		return s3ServeErr(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+	}
+	return nil
+}
+
+func notImplemented() error {
+	return s3ServeErr(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented by nuv s3 serve.")
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter) error {
+	buckets, err := s.store.buckets()
+	if err != nil {
+		return err
+	}
+	type xmlBucket struct {
+		Name         string
+		CreationDate time.Time
+	}
+	res := struct {
+		XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+		Xmlns   string      `xml:"xmlns,attr"`
+		Owner   struct{ ID string }
+		Buckets []xmlBucket `xml:"Buckets>Bucket"`
+	}{Xmlns: s3XMLNamespace}
+	res.Owner.ID = s.accessKey
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, xmlBucket{Name: b.Name, CreationDate: b.Created})
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		if unsupportedParams(query, func(string) bool { return false }) {
+			return notImplemented()
+		}
+		if err := s.store.createBucket(bucket); err != nil {
+			return err
+		}
+		w.Header().Set("Location", "/"+bucket)
+		return nil
+	case http.MethodHead:
+		if !s.store.bucketExists(bucket) {
+			return errNoSuchBucket(bucket)
+		}
+		return nil
+	case http.MethodDelete:
+		if err := s.store.deleteBucket(bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case http.MethodPost:
+		if _, ok := query["delete"]; ok {
+			return s.deleteObjects(w, r, bucket)
+		}
+	case http.MethodGet:
+		if _, ok := query["uploads"]; ok {
+			return s.listUploads(w, r, bucket)
+		}
+		if _, ok := query["location"]; ok {
+			return writeXML(w, http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: s3XMLNamespace})
+		}
+		if unsupportedParams(query, func(k string) bool { return listParams[k] }) {
+			return notImplemented()
+		}
+		return s.listObjects(w, r, bucket)
+	}
+	return notImplemented()
+}
+
+func isPresigned(query url.Values) bool {
+	return query.Get("X-Amz-Algorithm") != ""
+}
+
+// listParams are the parameters of the listings, the other ones select
+// subresources like ?cors or ?acl, that are not implemented
+var listParams = map[string]bool{
+	"prefix": true, "delimiter": true, "max-keys": true, "marker": true, "list-type": true,
+	"start-after": true, "continuation-token": true, "encoding-type": true, "fetch-owner": true,
+}
+
+func unsupportedParams(query url.Values, supported func(string) bool) bool {
+	for k := range query {
+		if !strings.HasPrefix(k, "X-Amz-") && !supported(k) {
+			return true
+		}
+	}
+	return false
+}
+
+type xmlObject struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type xmlPrefix struct {
+	Prefix string
+}
+
+// listObjects answers both versions of the listing, paginating on the
+// last returned key or common prefix
+func (s *s3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	v2 := query.Get("list-type") == "2"
+	maxKeys := 1000
+	if m := query.Get("max-keys"); m != "" {
+		n, err := strconv.Atoi(m)
+		if err != nil || n < 0 {
+			return s3ServeErr(http.StatusBadRequest, "InvalidArgument", "max-keys must be a non negative integer")
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.StdEncoding.DecodeString(token)
+			if err != nil {
+				return s3ServeErr(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			}
+			after = string(decoded)
+		}
+	}
+
+	objects, err := s.store.objects(bucket)
+	if err != nil {
+		return err
+	}
+	contents := []xmlObject{}
+	prefixes := []xmlPrefix{}
+	truncated := false
+	last := ""
+	for _, obj := range objects {
+		if !strings.HasPrefix(obj.Key, prefix) || obj.Key <= after {
+			continue
+		}
+		entry := obj.Key
+		if delimiter != "" {
+			if i := strings.Index(obj.Key[len(prefix):], delimiter); i >= 0 {
+				entry = obj.Key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		// the keys of a prefix returned in a previous page
+		if entry == last || strings.HasPrefix(after, entry) && entry != obj.Key {
+			continue
+		}
+		if len(contents)+len(prefixes) >= maxKeys {
+			truncated = true
+			break
+		}
+		if entry != obj.Key {
+			prefixes = append(prefixes, xmlPrefix{Prefix: entry})
+		} else {
+			contents = append(contents, xmlObject{Key: obj.Key, LastModified: obj.Modified, ETag: obj.ETag, Size: obj.Size, StorageClass: "STANDARD"})
+		}
+		last = entry
+	}
+
+	res := struct {
+		XMLName               xml.Name    `xml:"ListBucketResult"`
+		Xmlns                 string      `xml:"xmlns,attr"`
+		Name                  string      `xml:"Name"`
+		Prefix                string      `xml:"Prefix"`
+		Delimiter             string      `xml:"Delimiter,omitempty"`
+		MaxKeys               int         `xml:"MaxKeys"`
+		IsTruncated           bool        `xml:"IsTruncated"`
+		Marker                string      `xml:"Marker,omitempty"`
+		NextMarker            string      `xml:"NextMarker,omitempty"`
+		KeyCount              int         `xml:"KeyCount,omitempty"`
+		StartAfter            string      `xml:"StartAfter,omitempty"`
+		ContinuationToken     string      `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string      `xml:"NextContinuationToken,omitempty"`
+		Contents              []xmlObject `xml:"Contents"`
+		CommonPrefixes        []xmlPrefix `xml:"CommonPrefixes"`
+	}{
+		Xmlns:          s3XMLNamespace,
+		Name:           bucket,
+		Prefix:         prefix,
+		Delimiter:      delimiter,
+		MaxKeys:        maxKeys,
+		IsTruncated:    truncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	}
+	if v2 {
+		res.KeyCount = len(contents) + len(prefixes)
+		res.StartAfter = query.Get("start-after")
+		res.ContinuationToken = query.Get("continuation-token")
+		if truncated {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		res.Marker = query.Get("marker")
+		if truncated {
+			res.NextMarker = last
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var req struct {
+		Quiet   bool
+		Objects []struct{ Key string } `xml:"Object"`
+	}
+	if err := readXML(r, &req); err != nil {
+		return err
+	}
+	if len(req.Objects) > 1000 {
+		return s3ServeErr(http.StatusBadRequest, "MalformedXML", "At most 1000 objects can be deleted in a request.")
+	}
+	type xmlDeleted struct{ Key string }
+	type xmlDeleteError struct{ Key, Code, Message string }
+	res := struct {
+		XMLName xml.Name         `xml:"DeleteResult"`
+		Xmlns   string           `xml:"xmlns,attr"`
+		Deleted []xmlDeleted     `xml:"Deleted"`
+		Errors  []xmlDeleteError `xml:"Error"`
+	}{Xmlns: s3XMLNamespace}
+	for _, obj := range req.Objects {
+		if err := s.store.deleteObject(bucket, obj.Key); err != nil {
+			var serr *s3ServeError
+			if errors.As(err, &serr) && serr.Code == "NoSuchBucket" {
+				return err
+			}
+			res.Errors = append(res.Errors, xmlDeleteError{Key: obj.Key, Code: "InternalError", Message: err.Error()})
+		} else if !req.Quiet {
+			res.Deleted = append(res.Deleted, xmlDeleted{Key: obj.Key})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) listUploads(w http.ResponseWriter, r *http.Request, bucket string) error {
+	uploads, err := s.store.uploads(bucket)
+	if err != nil {
+		return err
+	}
+	prefix := r.URL.Query().Get("prefix")
+	type xmlUpload struct {
+		Key       string
+		UploadId  string
+		Initiated time.Time
+	}
+	res := struct {
+		XMLName     xml.Name    `xml:"ListMultipartUploadsResult"`
+		Xmlns       string      `xml:"xmlns,attr"`
+		Bucket      string      `xml:"Bucket"`
+		Prefix      string      `xml:"Prefix"`
+		IsTruncated bool        `xml:"IsTruncated"`
+		Uploads     []xmlUpload `xml:"Upload"`
+	}{Xmlns: s3XMLNamespace, Bucket: bucket, Prefix: prefix}
+	for _, u := range uploads {
+		if strings.HasPrefix(u.Key, prefix) {
+			res.Uploads = append(res.Uploads, xmlUpload{Key: u.Key, UploadId: u.ID, Initiated: u.Initiated})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	supported := func(k string) bool {
+		return k == "uploadId" || k == "uploads" || k == "partNumber" || strings.HasPrefix(k, "response-")
+	}
+	if unsupportedParams(query, supported) {
+		return notImplemented()
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if uploadID != "" {
+			return s.listParts(w, bucket, key, uploadID)
+		}
+		return s.getObject(w, r, bucket, key)
+	case http.MethodPut:
+		if uploadID != "" {
+			number, err := strconv.ParseInt(query.Get("partNumber"), 10, 64)
+			if err != nil {
+				return s3ServeErr(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+			}
+			etag, err := s.store.putPart(bucket, key, uploadID, number, r.Body)
+			if err != nil {
+				return err
+			}
+			w.Header().Set("ETag", etag)
+			return nil
+		}
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			return s.copyObject(w, r, source, bucket, key)
+		}
+		obj, err := s.store.putObject(bucket, objectFromRequest(r, key), r.Body, r.Header.Get("Content-MD5"))
+		if err != nil {
+			return err
+		}
+		w.Header().Set("ETag", obj.ETag)
+		return nil
+	case http.MethodPost:
+		if _, ok := query["uploads"]; ok {
+			stored := objectFromRequest(r, key)
+			upload, err := s.store.createUpload(bucket, s3StoredUpload{Key: key, Headers: stored.Headers, Metadata: stored.Metadata})
+			if err != nil {
+				return err
+			}
+			return writeXML(w, http.StatusOK, struct {
+				XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+				Xmlns    string   `xml:"xmlns,attr"`
+				Bucket   string
+				Key      string
+				UploadId string
+			}{Xmlns: s3XMLNamespace, Bucket: bucket, Key: key, UploadId: upload.ID})
+		}
+		if uploadID != "" {
+			return s.completeUpload(w, r, bucket, key, uploadID)
+		}
+	case http.MethodDelete:
+		if uploadID != "" {
+			if err := s.store.abortUpload(bucket, key, uploadID); err != nil {
+				return err
+			}
+		} else if err := s.store.deleteObject(bucket, key); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return notImplemented()
+}
+
+// storedHeaders are the headers of the uploads returned by the downloads
+var storedHeaders = []string{"Content-Type", "Cache-Control", "Content-Encoding", "Content-Disposition", "Content-Language", "Expires"}
+
+func objectFromRequest(r *http.Request, key string) s3StoredObject {
+	obj := s3StoredObject{Key: key, Headers: map[string]string{}, Metadata: map[string]string{}}
+	for _, name := range storedHeaders {
+		if v := r.Header.Get(name); v != "" {
+			obj.Headers[name] = v
+		}
+	}
+	if obj.Headers["Content-Type"] == "" {
+		obj.Headers["Content-Type"] = "binary/octet-stream"
+	}
+	for name, values := range r.Header {
+		if meta := strings.TrimPrefix(strings.ToLower(name), "x-amz-meta-"); meta != strings.ToLower(name) {
+			obj.Metadata[meta] = strings.Join(values, ",")
+		}
+	}
+	return obj
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	obj, f, err := s.store.openObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for name, v := range obj.Headers {
+		w.Header().Set(name, v)
+	}
+	for name, v := range obj.Metadata {
+		w.Header().Set("X-Amz-Meta-"+name, v)
+	}
+	w.Header().Set("ETag", obj.ETag)
+	// the overrides of the presigned urls, like response-content-disposition
+	for k, v := range r.URL.Query() {
+		if name := strings.TrimPrefix(k, "response-"); name != k {
+			w.Header().Set(name, v[0])
+		}
+	}
+	// ranges and conditional requests, as S3 does
+	http.ServeContent(w, r, "", obj.Modified, f)
+	return nil
+}
+
+func (s *s3Server) copyObject(w http.ResponseWriter, r *http.Request, source, bucket, key string) error {
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return s3ServeErr(http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	srcBucket, srcKey, ok := strings.Cut(source, "/")
+	if !ok || srcKey == "" {
+		return s3ServeErr(http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	replace := r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE"
+	obj, err := s.store.copyObject(srcBucket, srcKey, bucket, objectFromRequest(r, key), replace)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		LastModified time.Time
+		ETag         string
+	}{Xmlns: s3XMLNamespace, LastModified: time.Now().UTC().Truncate(time.Second), ETag: obj.ETag})
+}
+
+func (s *s3Server) listParts(w http.ResponseWriter, bucket, key, uploadID string) error {
+	parts, err := s.store.parts(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	type xmlPart struct {
+		PartNumber   int64
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+	res := struct {
+		XMLName     xml.Name  `xml:"ListPartsResult"`
+		Xmlns       string    `xml:"xmlns,attr"`
+		Bucket      string    `xml:"Bucket"`
+		Key         string    `xml:"Key"`
+		UploadId    string    `xml:"UploadId"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Parts       []xmlPart `xml:"Part"`
+	}{Xmlns: s3XMLNamespace, Bucket: bucket, Key: key, UploadId: uploadID}
+	for _, p := range parts {
+		res.Parts = append(res.Parts, xmlPart{PartNumber: p.Number, LastModified: p.Modified, ETag: p.ETag, Size: p.Size})
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	var req struct {
+		Parts []struct {
+			PartNumber int64
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := readXML(r, &req); err != nil {
+		return err
+	}
+	parts := []s3StoredPart{}
+	for _, p := range req.Parts {
+		parts = append(parts, s3StoredPart{Number: p.PartNumber, ETag: p.ETag})
+	}
+	obj, err := s.store.completeUpload(bucket, key, uploadID, parts)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Xmlns: s3XMLNamespace, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: obj.ETag})
+}
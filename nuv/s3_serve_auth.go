@@ -0,0 +1,298 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// maxClockSkew is the difference allowed between the signing and the server time
+	maxClockSkew = 15 * time.Minute
+)
+
+// sigV4Request holds the parts of a signature, from the Authorization header
+// or from the query of a presigned url
+type sigV4Request struct {
+	accessKey     string
+	scope         string
+	date          time.Time
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	presigned     bool
+}
+
+// verifySigV4 checks the signature version 4 of the request with the credentials
+// of the server; the payload hash is verified while the body is read
+func verifySigV4(r *http.Request, accessKey, secretKey string, now time.Time) error {
+	sig, err := parseSigV4(r, now)
+	if err != nil {
+		return err
+	}
+	if sig.accessKey != accessKey {
+		return s3ServeErr(http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records.")
+	}
+	if !sig.presigned && (now.Sub(sig.date) > maxClockSkew || sig.date.Sub(now) > maxClockSkew) {
+		return s3ServeErr(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+	}
+
+	canonical := canonicalSigV4Request(r, sig)
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{sigV4Algorithm, sig.date.Format(sigV4TimeFormat), sig.scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range strings.Split(sig.scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(sig.signature)) != 1 {
+		return s3ServeErr(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+	}
+
+	switch {
+	case strings.HasPrefix(sig.payloadHash, "STREAMING-"):
+		// aws-chunked bodies carry a signature per chunk, only the data is kept
+		r.Body = io.NopCloser(newAwsChunkedReader(r.Body))
+	case sig.payloadHash != unsignedPayload:
+		r.Body = &payloadVerifier{ReadCloser: r.Body, hash: sha256.New(), expected: sig.payloadHash}
+	}
+	return nil
+}
+
+func parseSigV4(r *http.Request, now time.Time) (*sigV4Request, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return parsePresignedSigV4(r, now)
+	}
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, s3ServeErr(http.StatusForbidden, "AccessDenied", "Anonymous access is not allowed, sign the requests with the credentials printed by nuv s3 serve.")
+	}
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return nil, s3ServeErr(http.StatusBadRequest, "InvalidRequest", "Only the "+sigV4Algorithm+" signature is supported.")
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[k] = v
+	}
+	sig := &sigV4Request{
+		signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		signature:     fields["Signature"],
+		payloadHash:   r.Header.Get("X-Amz-Content-Sha256"),
+	}
+	if sig.payloadHash == "" {
+		return nil, s3ServeErr(http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256")
+	}
+	if err := sig.parseCredential(fields["Credential"], r.Header.Get("X-Amz-Date")); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func parsePresignedSigV4(r *http.Request, now time.Time) (*sigV4Request, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+		return nil, s3ServeErr(http.StatusBadRequest, "InvalidRequest", "Only the "+sigV4Algorithm+" signature is supported.")
+	}
+	sig := &sigV4Request{
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+		presigned:     true,
+	}
+	if err := sig.parseCredential(query.Get("X-Amz-Credential"), query.Get("X-Amz-Date")); err != nil {
+		return nil, err
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > 604800 {
+		return nil, s3ServeErr(http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 and 604800 seconds.")
+	}
+	if now.After(sig.date.Add(time.Duration(expires) * time.Second)) {
+		return nil, s3ServeErr(http.StatusForbidden, "AccessDenied", "Request has expired")
+	}
+	return sig, nil
+}
+
+// parseCredential splits AKID/20220501/us-east-1/s3/aws4_request
+func (sig *sigV4Request) parseCredential(credential, date string) error {
+	accessKey, scope, ok := strings.Cut(credential, "/")
+	if !ok || len(strings.Split(scope, "/")) != 4 || !strings.HasSuffix(scope, "/aws4_request") {
+		return s3ServeErr(http.StatusBadRequest, "AuthorizationHeaderMalformed", "The credential scope is malformed.")
+	}
+	t, err := time.Parse(sigV4TimeFormat, date)
+	if err != nil || !strings.HasPrefix(scope, t.Format("20060102")+"/") {
+		return s3ServeErr(http.StatusBadRequest, "AuthorizationHeaderMalformed", "The date of the request is missing or does not match the credential scope.")
+	}
+	sig.accessKey = accessKey
+	sig.scope = scope
+	sig.date = t
+	return nil
+}
+
+func canonicalSigV4Request(r *http.Request, sig *sigV4Request) string {
+	// the path as sent: S3 does not normalize nor escape it again
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	if path == "" || strings.HasPrefix(path, "http") {
+		path = r.URL.EscapedPath()
+	}
+
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if k != "X-Amz-Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, sigV4Escape(k)+"="+sigV4Escape(v))
+		}
+	}
+
+	headers := []string{}
+	for _, name := range sig.signedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		case "transfer-encoding":
+			value = strings.Join(r.TransferEncoding, ",")
+		default:
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		headers = append(headers, name+":"+strings.Join(strings.Fields(value), " ")+"\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		path,
+		strings.Join(params, "&"),
+		strings.Join(headers, ""),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+// sigV4Escape encodes all but the unreserved characters of RFC 3986
+func sigV4Escape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// payloadVerifier fails the last read when the body does not match the signed hash
+type payloadVerifier struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (p *payloadVerifier) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	p.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(p.hash.Sum(nil)) != p.expected {
+		return n, s3ServeErr(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+	}
+	return n, err
+}
+
+// awsChunkedReader decodes the aws-chunked encoding:
+// <hex size>;chunk-signature=<signature>\r\n<data>\r\n ... 0;...\r\n<trailers>
+type awsChunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func newAwsChunkedReader(r io.Reader) *awsChunkedReader {
+	return &awsChunkedReader{r: bufio.NewReader(r)}
+}
+
+func (c *awsChunkedReader) Read(b []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, s3ServeErr(http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is truncated.")
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		c.remaining, err = strconv.ParseInt(size, 16, 64)
+		if err != nil || c.remaining < 0 {
+			return 0, s3ServeErr(http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is malformed.")
+		}
+		if c.remaining == 0 {
+			// the trailers are not needed
+			c.done = true
+			io.Copy(io.Discard, c.r)
+			return 0, io.EOF
+		}
+	}
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.r.Read(b)
+	c.remaining -= int64(n)
+	if c.remaining == 0 {
+		// the \r\n after the data
+		if _, err := c.r.Discard(2); err != nil {
+			return n, s3ServeErr(http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is truncated.")
+		}
+	}
+	if err == io.EOF && c.remaining > 0 {
+		err = s3ServeErr(http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is truncated.")
+	}
+	return n, err
+}
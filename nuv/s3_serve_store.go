@@ -0,0 +1,491 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// bucketFile marks a folder of the store as a bucket and holds its creation date
+	bucketFile = ".bucket.json"
+	// uploadsFolder holds the parts of the incomplete multipart uploads
+	uploadsFolder = ".uploads"
+)
+
+var bucketNameRule = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// s3Store keeps a bucket per folder; objects are saved by the hash of
+// their key, as <hash> for the content and <hash>.json for the metadata,
+// so that any key, even "a" and "a/b", can be stored
+type s3Store struct {
+	root string
+	mu   sync.RWMutex
+}
+
+// s3StoredObject is the metadata of an object
+type s3StoredObject struct {
+	Key      string            `json:"key"`
+	Size     int64             `json:"size"`
+	ETag     string            `json:"etag"`
+	Modified time.Time         `json:"modified"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type s3StoredBucket struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// s3StoredUpload is an incomplete multipart upload
+type s3StoredUpload struct {
+	ID        string            `json:"id"`
+	Bucket    string            `json:"bucket"`
+	Key       string            `json:"key"`
+	Initiated time.Time         `json:"initiated"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type s3StoredPart struct {
+	Number   int64
+	Size     int64
+	ETag     string
+	Modified time.Time
+}
+
+func newS3Store(root string) (*s3Store, error) {
+	if err := os.MkdirAll(filepath.Join(root, uploadsFolder), 0700); err != nil {
+		return nil, err
+	}
+	return &s3Store{root: root}, nil
+}
+
+func errNoSuchBucket(bucket string) error {
+	return s3ServeErr(http.StatusNotFound, "NoSuchBucket", fmt.Sprintf("The specified bucket %s does not exist", bucket))
+}
+
+func errNoSuchKey(key string) error {
+	return s3ServeErr(http.StatusNotFound, "NoSuchKey", fmt.Sprintf("The specified key %s does not exist.", key))
+}
+
+func errNoSuchUpload(id string) error {
+	return s3ServeErr(http.StatusNotFound, "NoSuchUpload", fmt.Sprintf("The specified multipart upload %s does not exist.", id))
+}
+
+func (s *s3Store) bucketPath(bucket string) string {
+	return filepath.Join(s.root, bucket)
+}
+
+func (s *s3Store) objectPath(bucket, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.root, bucket, hex.EncodeToString(sum[:]))
+}
+
+func (s *s3Store) bucketExists(bucket string) bool {
+	return bucketNameRule.MatchString(bucket) && fileExists(filepath.Join(s.bucketPath(bucket), bucketFile))
+}
+
+func (s *s3Store) buckets() ([]s3StoredBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	res := []s3StoredBucket{}
+	for _, e := range entries {
+		var b s3StoredBucket
+		if err := readStoreJSON(filepath.Join(s.root, e.Name(), bucketFile), &b); err == nil {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
+
+func (s *s3Store) createBucket(bucket string) error {
+	if !bucketNameRule.MatchString(bucket) {
+		return s3ServeErr(http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid.")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bucketExists(bucket) {
+		return s3ServeErr(http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+	if err := os.MkdirAll(s.bucketPath(bucket), 0700); err != nil {
+		return err
+	}
+	return writeStoreJSON(filepath.Join(s.bucketPath(bucket), bucketFile), s3StoredBucket{Name: bucket, Created: time.Now().UTC()})
+}
+
+func (s *s3Store) deleteBucket(bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.bucketExists(bucket) {
+		return errNoSuchBucket(bucket)
+	}
+	entries, err := os.ReadDir(s.bucketPath(bucket))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() != bucketFile {
+			return s3ServeErr(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+		}
+	}
+	return os.RemoveAll(s.bucketPath(bucket))
+}
+
+// objects returns the metadata of all the objects of the bucket, sorted by key
+func (s *s3Store) objects(bucket string) ([]s3StoredObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.bucketExists(bucket) {
+		return nil, errNoSuchBucket(bucket)
+	}
+	matches, err := filepath.Glob(filepath.Join(s.bucketPath(bucket), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	res := []s3StoredObject{}
+	for _, m := range matches {
+		if filepath.Base(m) == bucketFile {
+			continue
+		}
+		var obj s3StoredObject
+		if err := readStoreJSON(m, &obj); err != nil {
+			return nil, err
+		}
+		res = append(res, obj)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res, nil
+}
+
+func (s *s3Store) headObject(bucket, key string) (s3StoredObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readObject(bucket, key)
+}
+
+func (s *s3Store) readObject(bucket, key string) (s3StoredObject, error) {
+	var obj s3StoredObject
+	if !s.bucketExists(bucket) {
+		return obj, errNoSuchBucket(bucket)
+	}
+	err := readStoreJSON(s.objectPath(bucket, key)+".json", &obj)
+	if errors.Is(err, fs.ErrNotExist) {
+		return obj, errNoSuchKey(key)
+	}
+	return obj, err
+}
+
+// openObject returns the metadata and the content, that stays readable
+// even if the object is replaced in the meantime
+func (s *s3Store) openObject(bucket, key string) (s3StoredObject, *os.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, err := s.readObject(bucket, key)
+	if err != nil {
+		return obj, nil, err
+	}
+	f, err := os.Open(s.objectPath(bucket, key))
+	return obj, f, err
+}
+
+// putObject streams the body to a temporary file, then replaces the object
+func (s *s3Store) putObject(bucket string, obj s3StoredObject, body io.Reader, contentMD5 string) (s3StoredObject, error) {
+	if !s.bucketExists(bucket) {
+		return obj, errNoSuchBucket(bucket)
+	}
+	tmp, size, sum, err := s.writeTemp(s.bucketPath(bucket), body)
+	if err != nil {
+		return obj, err
+	}
+	defer os.Remove(tmp)
+	if contentMD5 != "" && contentMD5 != base64.StdEncoding.EncodeToString(sum) {
+		return obj, s3ServeErr(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+	}
+	obj.Size = size
+	obj.ETag = `"` + hex.EncodeToString(sum) + `"`
+	return obj, s.commitObject(bucket, obj, tmp)
+}
+
+func (s *s3Store) commitObject(bucket string, obj s3StoredObject, tmp string) error {
+	obj.Modified = time.Now().UTC().Truncate(time.Second)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.bucketExists(bucket) {
+		return errNoSuchBucket(bucket)
+	}
+	path := s.objectPath(bucket, obj.Key)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return writeStoreJSON(path+".json", obj)
+}
+
+// writeTemp saves the body in dir, returning the file, its size and md5
+func (s *s3Store) writeTemp(dir string, body io.Reader) (string, int64, []byte, error) {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", 0, nil, err
+	}
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, nil, err
+	}
+	return f.Name(), size, hash.Sum(nil), nil
+}
+
+func (s *s3Store) copyObject(srcBucket, srcKey, bucket string, obj s3StoredObject, replace bool) (s3StoredObject, error) {
+	src, f, err := s.openObject(srcBucket, srcKey)
+	if err != nil {
+		return obj, err
+	}
+	defer f.Close()
+	if !replace {
+		obj.Headers = src.Headers
+		obj.Metadata = src.Metadata
+	}
+	return s.putObject(bucket, obj, f, "")
+}
+
+func (s *s3Store) deleteObject(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.bucketExists(bucket) {
+		return errNoSuchBucket(bucket)
+	}
+	path := s.objectPath(bucket, key)
+	// deleting a missing object is not an error
+	if err := os.Remove(path + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *s3Store) uploadPath(id string) string {
+	return filepath.Join(s.root, uploadsFolder, filepath.Base(id))
+}
+
+func (s *s3Store) createUpload(bucket string, upload s3StoredUpload) (s3StoredUpload, error) {
+	if !s.bucketExists(bucket) {
+		return upload, errNoSuchBucket(bucket)
+	}
+	upload.ID = GenerateUUID()
+	upload.Bucket = bucket
+	upload.Initiated = time.Now().UTC().Truncate(time.Second)
+	if err := os.MkdirAll(s.uploadPath(upload.ID), 0700); err != nil {
+		return upload, err
+	}
+	return upload, writeStoreJSON(filepath.Join(s.uploadPath(upload.ID), "upload.json"), upload)
+}
+
+func (s *s3Store) upload(bucket, key, id string) (s3StoredUpload, error) {
+	var upload s3StoredUpload
+	err := readStoreJSON(filepath.Join(s.uploadPath(id), "upload.json"), &upload)
+	if err != nil || upload.Bucket != bucket || upload.Key != key {
+		return upload, errNoSuchUpload(id)
+	}
+	return upload, nil
+}
+
+func (s *s3Store) uploads(bucket string) ([]s3StoredUpload, error) {
+	if !s.bucketExists(bucket) {
+		return nil, errNoSuchBucket(bucket)
+	}
+	matches, err := filepath.Glob(filepath.Join(s.root, uploadsFolder, "*", "upload.json"))
+	if err != nil {
+		return nil, err
+	}
+	res := []s3StoredUpload{}
+	for _, m := range matches {
+		var upload s3StoredUpload
+		if err := readStoreJSON(m, &upload); err == nil && upload.Bucket == bucket {
+			res = append(res, upload)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Key != res[j].Key {
+			return res[i].Key < res[j].Key
+		}
+		return res[i].Initiated.Before(res[j].Initiated)
+	})
+	return res, nil
+}
+
+func (s *s3Store) putPart(bucket, key, id string, number int64, body io.Reader) (string, error) {
+	if _, err := s.upload(bucket, key, id); err != nil {
+		return "", err
+	}
+	if number < 1 || number > 10000 {
+		return "", s3ServeErr(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+	}
+	tmp, _, sum, err := s.writeTemp(s.uploadPath(id), body)
+	if err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(sum)
+	return `"` + etag + `"`, os.Rename(tmp, filepath.Join(s.uploadPath(id), fmt.Sprintf("%05d-%s", number, etag)))
+}
+
+func (s *s3Store) parts(bucket, key, id string) ([]s3StoredPart, error) {
+	if _, err := s.upload(bucket, key, id); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.uploadPath(id))
+	if err != nil {
+		return nil, err
+	}
+	res := []s3StoredPart{}
+	for _, e := range entries {
+		var part s3StoredPart
+		var etag string
+		if _, err := fmt.Sscanf(strings.Replace(e.Name(), "-", " ", 1), "%d %s", &part.Number, &etag); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		part.ETag = `"` + etag + `"`
+		part.Size = info.Size()
+		part.Modified = info.ModTime().UTC()
+		// a part uploaded again replaces the previous one
+		if n := len(res); n > 0 && res[n-1].Number == part.Number {
+			if res[n-1].Modified.After(part.Modified) {
+				continue
+			}
+			res = res[:n-1]
+		}
+		res = append(res, part)
+	}
+	return res, nil
+}
+
+// completeUpload joins the requested parts, with the etag of S3:
+// the md5 of the md5 of the parts, followed by the number of parts
+func (s *s3Store) completeUpload(bucket, key, id string, requested []s3StoredPart) (s3StoredObject, error) {
+	upload, err := s.upload(bucket, key, id)
+	if err != nil {
+		return s3StoredObject{}, err
+	}
+	available, err := s.parts(bucket, key, id)
+	if err != nil {
+		return s3StoredObject{}, err
+	}
+	byNumber := map[int64]s3StoredPart{}
+	for _, p := range available {
+		byNumber[p.Number] = p
+	}
+	if len(requested) == 0 {
+		return s3StoredObject{}, s3ServeErr(http.StatusBadRequest, "MalformedXML", "You must specify at least one part")
+	}
+	files := []io.Reader{}
+	hash := md5.New()
+	for i, p := range requested {
+		stored, ok := byNumber[p.Number]
+		if !ok || strings.Trim(stored.ETag, `"`) != strings.Trim(p.ETag, `"`) {
+			return s3StoredObject{}, s3ServeErr(http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d was not uploaded or its ETag does not match.", p.Number))
+		}
+		if i > 0 && p.Number <= requested[i-1].Number {
+			return s3StoredObject{}, s3ServeErr(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+		}
+		f, err := os.Open(filepath.Join(s.uploadPath(id), fmt.Sprintf("%05d-%s", p.Number, strings.Trim(stored.ETag, `"`))))
+		if err != nil {
+			return s3StoredObject{}, err
+		}
+		defer f.Close()
+		files = append(files, f)
+		sum, _ := hex.DecodeString(strings.Trim(stored.ETag, `"`))
+		hash.Write(sum)
+	}
+	if !s.bucketExists(bucket) {
+		return s3StoredObject{}, errNoSuchBucket(bucket)
+	}
+	tmp, size, _, err := s.writeTemp(s.bucketPath(bucket), io.MultiReader(files...))
+	if err != nil {
+		return s3StoredObject{}, err
+	}
+	defer os.Remove(tmp)
+	obj := s3StoredObject{
+		Key:      key,
+		Size:     size,
+		ETag:     fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(hash.Sum(nil)), len(requested)),
+		Headers:  upload.Headers,
+		Metadata: upload.Metadata,
+	}
+	if err := s.commitObject(bucket, obj, tmp); err != nil {
+		return obj, err
+	}
+	return obj, os.RemoveAll(s.uploadPath(id))
+}
+
+func (s *s3Store) abortUpload(bucket, key, id string) error {
+	if _, err := s.upload(bucket, key, id); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.uploadPath(id))
+}
+
+func readStoreJSON(path string, v any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// writeStoreJSON replaces the file atomically, so readers never see it half written
+func writeStoreJSON(path string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,221 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// s3StandIn starts nuv s3 serve on a temporary folder, returning a real client:
+// use it to test the s3 commands end to end
+func s3StandIn(t *testing.T) (s3iface.S3API, string) {
+	store, err := newS3Store(t.TempDir())
+	assert.NoError(t, err)
+	server := httptest.NewServer(newS3Server(store, "AKIASTANDIN", "stand-in-secret"))
+	t.Cleanup(server.Close)
+	conf := buildAwsConfig(s3SecretsJSON{Id: "AKIASTANDIN", Key: "stand-in-secret", Region: defaultS3Region, Endpoint: server.URL})
+	return s3.New(session.Must(session.NewSession(conf))), server.URL
+}
+
+func Test_s3ServeObjects(t *testing.T) {
+	svc, _ := s3StandIn(t)
+	assert.NoError(t, createBucket(svc, "web"))
+	assert.EqualError(t, createBucket(svc, "web"), "BucketAlreadyOwnedByYou: Your previous request to create the named bucket succeeded and you already own it.")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	os.WriteFile(file, []byte("<h1>hello</h1>"), 0644)
+	object := objectFlags{CacheControl: "no-cache", Metadata: map[string]string{"build": "42"}}
+	assert.NoError(t, prepareUpload(file, "site/index.html", object)(svc, "web"))
+
+	out, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("web"), Key: aws.String("site/index.html")})
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(out.Body)
+	assert.Equal(t, "<h1>hello</h1>", string(content))
+	assert.Equal(t, "text/html; charset=utf-8", aws.StringValue(out.ContentType))
+	assert.Equal(t, "no-cache", aws.StringValue(out.CacheControl))
+	assert.Equal(t, "42", aws.StringValue(out.Metadata["Build"]))
+	assert.Equal(t, `"a01618fc9b714c0e530f525e1bd6b123"`, aws.StringValue(out.ETag))
+
+	ranged, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("web"), Key: aws.String("site/index.html"), Range: aws.String("bytes=4-8")})
+	assert.NoError(t, err)
+	content, _ = io.ReadAll(ranged.Body)
+	assert.Equal(t, "hello", string(content))
+
+	f, bucket, err := prepareCopy("s3://web/site/index.html", "s3://web/copy/a b.html", objectFlags{})
+	assert.NoError(t, err)
+	assert.NoError(t, f(svc, bucket))
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("web"), Key: aws.String("copy/a b.html")})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(14), aws.Int64Value(head.ContentLength))
+	assert.Equal(t, "no-cache", aws.StringValue(head.CacheControl))
+
+	assert.EqualError(t, prepareRemoveBucket(false)(svc, "web"), `bucket "web" is not empty, use --force to remove its objects`)
+	assert.NoError(t, prepareRemove("copy/a b.html")(svc, "web"))
+	assert.EqualError(t, prepareRemove("copy/a b.html")(svc, "web"), `object "copy/a b.html" not found in bucket "web"`)
+	assert.NoError(t, prepareRemoveBucket(true)(svc, "web"))
+	assert.EqualError(t, prepareGet("site/index.html", filepath.Join(dir, "x"))(svc, "web"), `bucket "web" not found`)
+}
+
+func Test_s3ServeList(t *testing.T) {
+	svc, _ := s3StandIn(t)
+	assert.NoError(t, createBucket(svc, "docs"))
+	for _, key := range []string{"a.txt", "css/x.css", "css/y.css", "img/1.png", "img/2.png", "z.txt"} {
+		_, err := svc.PutObject(&s3.PutObjectInput{Bucket: aws.String("docs"), Key: aws.String(key), Body: strings.NewReader(key)})
+		assert.NoError(t, err)
+	}
+
+	pages := [][]string{}
+	err := svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String("docs"), Delimiter: aws.String("/"), MaxKeys: aws.Int64(2)},
+		func(page *s3.ListObjectsV2Output, last bool) bool {
+			entries := []string{}
+			for _, p := range page.CommonPrefixes {
+				entries = append(entries, aws.StringValue(p.Prefix))
+			}
+			for _, obj := range page.Contents {
+				entries = append(entries, aws.StringValue(obj.Key))
+			}
+			pages = append(pages, entries)
+			return true
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"css/", "a.txt"}, {"img/", "z.txt"}}, pages)
+
+	var out bytes.Buffer
+	assert.NoError(t, listBucketContent(svc, "docs", "img/", "", &out, "json"))
+	assert.Equal(t, 2, strings.Count(out.String(), "\n"))
+
+	plan, err := planSync(svc, t.TempDir(), "docs", "css/", &fileFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"css/x.css", "css/y.css"}, plan.deletes)
+	assert.NoError(t, plan.apply(svc, 2, false))
+	out.Reset()
+	assert.NoError(t, listBucketContent(svc, "docs", "css/", "", &out, "json"))
+	assert.Empty(t, out.String())
+}
+
+func Test_s3ServeMultipart(t *testing.T) {
+	svc, _ := s3StandIn(t)
+	assert.NoError(t, createBucket(svc, "big"))
+	file, content := writeParts(t)
+	cfg := uploadConfig{partSize: testPartSize, concurrency: 2}
+	assert.NoError(t, prepareMultipartUpload(file, "artifact.bin", cfg, false, NewLogger())(svc, "big"))
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("big"), Key: aws.String("artifact.bin")})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), aws.Int64Value(head.ContentLength))
+	assert.True(t, strings.HasSuffix(aws.StringValue(head.ETag), `-3"`))
+
+	// an interrupted upload is listed, resumed and completed
+	created, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("big"), Key: aws.String("resumed.bin")})
+	assert.NoError(t, err)
+	_, err = svc.UploadPart(&s3.UploadPartInput{Bucket: aws.String("big"), Key: aws.String("resumed.bin"), UploadId: created.UploadId,
+		PartNumber: aws.Int64(1), Body: bytes.NewReader(content[:testPartSize])})
+	assert.NoError(t, err)
+	id, err := findIncompleteUpload(svc, "big", "resumed.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, aws.StringValue(created.UploadId), id)
+	f, _ := os.Open(file)
+	defer f.Close()
+	progress := newUploadProgress(int64(len(content)), NewLogger())
+	assert.NoError(t, resumeUpload(svc, "big", "resumed.bin", id, f, int64(len(content)), cfg, progress))
+	out, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("big"), Key: aws.String("resumed.bin")})
+	assert.NoError(t, err)
+	resumed, _ := io.ReadAll(out.Body)
+	assert.Equal(t, content, resumed)
+
+	id, err = findIncompleteUpload(svc, "big", "resumed.bin")
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+}
+
+func Test_s3ServeAuth(t *testing.T) {
+	svc, endpoint := s3StandIn(t)
+	assert.NoError(t, createBucket(svc, "share"))
+
+	t.Run("should accept presigned uploads and downloads", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, preparePresign("notes.txt", "PUT", time.Minute, "text/plain", &out)(svc, "share"))
+		req, _ := http.NewRequest(http.MethodPut, strings.TrimSpace(out.String()), strings.NewReader("shared"))
+		req.Header.Set("Content-Type", "text/plain")
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		out.Reset()
+		assert.NoError(t, preparePresign("notes.txt", "GET", time.Minute, "", &out)(svc, "share"))
+		res, err = http.Get(strings.TrimSpace(out.String()))
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "shared", string(content))
+		assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+	})
+
+	t.Run("should reject a presigned upload with another content type", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, preparePresign("notes.txt", "PUT", time.Minute, "text/plain", &out)(svc, "share"))
+		req, _ := http.NewRequest(http.MethodPut, strings.TrimSpace(out.String()), strings.NewReader("<script>"))
+		req.Header.Set("Content-Type", "text/html")
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("should reject anonymous requests and wrong keys", func(t *testing.T) {
+		res, err := http.Get(endpoint + "/share/notes.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		conf := buildAwsConfig(s3SecretsJSON{Id: "AKIASTANDIN", Key: "wrong", Region: defaultS3Region, Endpoint: endpoint})
+		wrong := s3.New(session.Must(session.NewSession(conf)))
+		_, err = wrong.ListBuckets(&s3.ListBucketsInput{})
+		assert.ErrorContains(t, err, "SignatureDoesNotMatch")
+	})
+
+	t.Run("should reject expired urls", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, preparePresign("notes.txt", "GET", time.Minute, "", &out)(svc, "share"))
+		req := httptest.NewRequest(http.MethodGet, strings.TrimSpace(out.String()), nil)
+		err := verifySigV4(req, "AKIASTANDIN", "stand-in-secret", time.Now().Add(2*time.Minute))
+		assert.EqualError(t, err, "AccessDenied: Request has expired")
+	})
+}
+
+func Test_awsChunkedReader(t *testing.T) {
+	body := "5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\n\r\n"
+	content, err := io.ReadAll(newAwsChunkedReader(strings.NewReader(body)))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	_, err = io.ReadAll(newAwsChunkedReader(strings.NewReader("5;chunk-signature=abc\r\nhel")))
+	assert.ErrorContains(t, err, "IncompleteBody")
+}
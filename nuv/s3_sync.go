@@ -0,0 +1,254 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type s3sync struct {
+	Source      string   `arg:"" type:"existingdir" help:"the local folder to publish"`
+	Target      string   `arg:"" type:"string" help:"the bucket, optionally followed by /prefix"`
+	Delete      bool     `help:"remove the remote objects missing in the local folder"`
+	Dryrun      bool     `help:"show the changes without applying them"`
+	Concurrency int      `default:"4" help:"number of parallel transfers"`
+	Include     []string `help:"glob patterns of the files to sync (default: all files)"`
+	Exclude     []string `help:"glob patterns of the files to skip, in .gitignore syntax, besides the version control and system files; the matching objects are never deleted"`
+
+	objectFlags `embed:""`
+}
+
+func (c *s3sync) Run(opts s3Options) error {
+	if c.Concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	filter, err := newSyncFilter(c.Include, c.Exclude)
+	if err != nil {
+		return err
+	}
+	bucket, prefix := splitS3Target(c.Target)
+	return runS3With(opts, func(svc s3iface.S3API, bucketName string) error {
+		plan, err := planSync(svc, c.Source, bucketName, prefix, filter)
+		if err != nil {
+			return err
+		}
+		if !c.Delete {
+			plan.deletes = nil
+		}
+		plan.object = c.objectFlags
+		return plan.apply(svc, c.Concurrency, c.Dryrun)
+	}, bucket)
+}
+
+// newSyncFilter skips the version control and system files,
+// unless an include pattern names them
+func newSyncFilter(include, exclude []string) (*fileFilter, error) {
+	return newPatternFilter(include, append(liftDefaults(junkExcludes, include), exclude...))
+}
+
+// splitS3Target separates bucket and prefix, ending a prefix with /
+func splitS3Target(target string) (string, string) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, s3URLPrefix), "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket, prefix
+}
+
+type syncUpload struct {
+	file        string
+	key         string
+	contentType string
+}
+
+// syncPlan lists the changes to bring the bucket in line with the folder
+type syncPlan struct {
+	bucket    string
+	dir       string
+	uploads   []syncUpload
+	deletes   []string
+	unchanged int
+	object    objectFlags
+}
+
+// planSync compares the MD5 of the local files with the ETag of the objects
+// under the prefix; multipart ETags are not MD5, so those objects are uploaded again.
+// Only the objects selected by the filter are deleted
+func planSync(svc s3iface.S3API, dir, bucket, prefix string, filter *fileFilter) (*syncPlan, error) {
+	files, err := collectFiles(os.DirFS(dir), filter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := map[string]string{}
+	in := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	err = svc.ListObjectsV2Pages(in, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			remote[aws.StringValue(obj.Key)] = strings.Trim(aws.StringValue(obj.ETag), `"`)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, s3Error(err, bucket, prefix)
+	}
+
+	plan := &syncPlan{bucket: bucket, dir: dir}
+	for _, file := range files {
+		key := prefix + file
+		sum, ctype, err := md5AndContentType(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+		etag, found := remote[key]
+		delete(remote, key)
+		if found && etag == sum {
+			plan.unchanged++
+			continue
+		}
+		plan.uploads = append(plan.uploads, syncUpload{file: file, key: key, contentType: ctype})
+	}
+	for key := range remote {
+		if filter.selected(strings.TrimPrefix(key, prefix)) {
+			plan.deletes = append(plan.deletes, key)
+		}
+	}
+	sort.Strings(plan.deletes)
+	return plan, nil
+}
+
+func md5AndContentType(filename string) (string, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	hash := md5.New()
+	hash.Write(head[:n])
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), contentTypeOf(filename, head[:n]), nil
+}
+
+// apply runs the transfers with at most concurrency requests in flight,
+// stopping at the first error
+func (p *syncPlan) apply(svc s3iface.S3API, concurrency int, dryrun bool) error {
+	if dryrun {
+		for _, u := range p.uploads {
+			fmt.Printf("(dryrun) upload: %s to %s%s/%s\n", u.file, s3URLPrefix, p.bucket, u.key)
+		}
+		for _, key := range p.deletes {
+			fmt.Printf("(dryrun) delete: %s%s/%s\n", s3URLPrefix, p.bucket, key)
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, concurrency)
+	run := func(f func() (string, error)) {
+		slots <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-slots
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			msg, err := f()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err == nil {
+				fmt.Println(msg)
+			}
+		}()
+	}
+
+	for _, u := range p.uploads {
+		u := u
+		run(func() (string, error) {
+			return fmt.Sprintf("upload: %s to %s%s/%s", u.file, s3URLPrefix, p.bucket, u.key), p.upload(svc, u)
+		})
+	}
+	for _, key := range p.deletes {
+		key := key
+		run(func() (string, error) {
+			_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(p.bucket), Key: aws.String(key)})
+			if err != nil {
+				err = s3Error(err, p.bucket, key)
+			}
+			return fmt.Sprintf("delete: %s%s/%s", s3URLPrefix, p.bucket, key), err
+		})
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	fmt.Printf("Synced %s to %s%s: %d uploaded, %d deleted, %d unchanged\n",
+		p.dir, s3URLPrefix, p.bucket, len(p.uploads), len(p.deletes), p.unchanged)
+	return nil
+}
+
+func (p *syncPlan) upload(svc s3iface.S3API, u syncUpload) error {
+	f, err := os.Open(filepath.Join(p.dir, filepath.FromSlash(u.file)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(p.bucket),
+		Key:         aws.String(u.key),
+		Body:        f,
+		ContentType: aws.String(u.contentType),
+	}
+	p.object.putInput(in)
+	_, err = svc.PutObject(in)
+	if err != nil {
+		return s3Error(err, p.bucket, u.key)
+	}
+	return nil
+}
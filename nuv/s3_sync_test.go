@@ -0,0 +1,151 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// syncFixture is a site with an unchanged, a changed and a new file,
+// and a remote object missing locally
+func syncFixture(dir string) *mockS3Client {
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>hello</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, "css", "site.css"), []byte("h1 {}"), 0644)
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+	mockSvc := new(mockS3Client)
+	mockSvc.On("ListObjectsV2Pages", mock.Anything).Return([]*s3.ListObjectsV2Output{{
+		Contents: []*s3.Object{
+			// md5 of <h1>hello</h1>
+			{Key: aws.String("site/index.html"), ETag: aws.String(`"a01618fc9b714c0e530f525e1bd6b123"`)},
+			{Key: aws.String("site/css/site.css"), ETag: aws.String(`"outdated"`)},
+			{Key: aws.String("site/old.js"), ETag: aws.String(`"whatever"`)},
+		},
+	}}, nil)
+	return mockSvc
+}
+
+func Test_planSync(t *testing.T) {
+	dir := t.TempDir()
+	mockSvc := syncFixture(dir)
+
+	plan, err := planSync(mockSvc, dir, "www", "site/", &fileFilter{})
+	assert.NoError(t, err)
+	mockSvc.AssertCalled(t, "ListObjectsV2Pages", &s3.ListObjectsV2Input{Bucket: aws.String("www"), Prefix: aws.String("site/")})
+	assert.Equal(t, []syncUpload{
+		{file: "css/site.css", key: "site/css/site.css", contentType: "text/css; charset=utf-8"},
+		{file: "logo.png", key: "site/logo.png", contentType: "image/png"},
+	}, plan.uploads)
+	assert.Equal(t, []string{"site/old.js"}, plan.deletes)
+	assert.Equal(t, 1, plan.unchanged)
+}
+
+func Test_planSyncFilter(t *testing.T) {
+	dir := t.TempDir()
+	mockSvc := syncFixture(dir)
+	os.WriteFile(filepath.Join(dir, "app.js.map"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.png\n"), 0644)
+
+	// the bundle defaults and the .gitignore do not apply
+	plan, err := planSync(mockSvc, dir, "www", "site/", &fileFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, plan.uploads, 4)
+
+	// the excluded objects are neither uploaded nor deleted
+	filter, err := newPatternFilter(nil, []string{"*.js", "css/"})
+	assert.NoError(t, err)
+	plan, err = planSync(mockSvc, dir, "www", "site/", filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []syncUpload{
+		{file: ".gitignore", key: "site/.gitignore", contentType: "text/plain; charset=utf-8"},
+		{file: "app.js.map", key: "site/app.js.map", contentType: "application/json"},
+		{file: "logo.png", key: "site/logo.png", contentType: "image/png"},
+	}, plan.uploads)
+	assert.Empty(t, plan.deletes)
+}
+
+func Test_newSyncFilter(t *testing.T) {
+	filter, err := newSyncFilter(nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, filter.selected(".git/config"))
+	assert.False(t, filter.selected("img/.DS_Store"))
+	assert.True(t, filter.selected("app.js.map"))
+	assert.True(t, filter.selected(".gitignore"))
+
+	// an include pattern opts back in
+	filter, err = newSyncFilter([]string{".git/**"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, filter.selected(".git/config"))
+	assert.False(t, filter.selected("app.js"))
+	assert.False(t, filter.selected(".DS_Store"))
+}
+
+func Test_syncApply(t *testing.T) {
+	t.Run("should upload with the content type and delete", func(t *testing.T) {
+		dir := t.TempDir()
+		mockSvc := syncFixture(dir)
+		mockSvc.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+		mockSvc.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil)
+		plan, _ := planSync(mockSvc, dir, "www", "site/", &fileFilter{})
+		assert.NoError(t, plan.apply(mockSvc, 2, false))
+		mockSvc.AssertNumberOfCalls(t, "PutObject", 2)
+		mockSvc.AssertCalled(t, "PutObject", mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+			return *in.Key == "site/logo.png" && *in.ContentType == "image/png"
+		}))
+		mockSvc.AssertCalled(t, "DeleteObject", &s3.DeleteObjectInput{Bucket: aws.String("www"), Key: aws.String("site/old.js")})
+	})
+
+	t.Run("should return the error of a transfer", func(t *testing.T) {
+		dir := t.TempDir()
+		mockSvc := syncFixture(dir)
+		mockSvc.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, errors.New("failed"))
+		plan, _ := planSync(mockSvc, dir, "www", "site/", &fileFilter{})
+		plan.deletes = nil
+		assert.EqualError(t, plan.apply(mockSvc, 1, false), "failed")
+		mockSvc.AssertNumberOfCalls(t, "PutObject", 1)
+	})
+}
+
+func Test_splitS3Target(t *testing.T) {
+	bucket, prefix := splitS3Target("www")
+	assert.Equal(t, "www", bucket)
+	assert.Equal(t, "", prefix)
+	bucket, prefix = splitS3Target("s3://www/site")
+	assert.Equal(t, "www", bucket)
+	assert.Equal(t, "site/", prefix)
+}
+
+func Example_syncPlan_dryrun() {
+	dir, _ := os.MkdirTemp("", "sync")
+	defer os.RemoveAll(dir)
+	mockSvc := syncFixture(dir)
+	plan, _ := planSync(mockSvc, dir, "www", "site/", &fileFilter{})
+	plan.apply(mockSvc, 4, true)
+	// Output:
+	// (dryrun) upload: css/site.css to s3://www/site/css/site.css
+	// (dryrun) upload: logo.png to s3://www/site/logo.png
+	// (dryrun) delete: s3://www/site/old.js
+}
@@ -18,48 +18,96 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 	"testing/fstest"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
 )
 
-func Test_readS3Secrets(t *testing.T) {
-
-	t.Run("should return error when unable to read secrets.json", func(t *testing.T) {
-		emptyConfig := fstest.MapFS{"/": {Mode: fs.ModeDir}}
-		_, err := readS3Secrets(emptyConfig)
-		assert.Error(t, err)
-	})
+// clearAwsEnv hides the AWS variables of the machine running the tests
+func clearAwsEnv(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3"} {
+		t.Setenv(name, "")
+	}
+}
 
-	t.Run("should return s3Secrets when secrets.json is valid", func(t *testing.T) {
-		expected := s3SecretsJSON{
-			Id:     "some-id",
-			Key:    "some-key",
-			Region: "some-region",
-		}
-		secrets := `
+func Test_loadS3Secrets(t *testing.T) {
+	secrets := `
 {
 	"id": "some-id",
 	"key": "some-key",
-	"region": "some-region"
+	"region": "some-region",
+	"profiles": {
+		"external": {"id": "ext-id", "key": "ext-key", "region": "eu-west-1", "endpoint": "https://s3.example.com"}
+	}
 }`
+	clusterConfig := "s3:\n  id: cluster-id\n  key: cluster-key\n  region: eu-central-1\n"
+
+	t.Run("should return error when no secrets are found", func(t *testing.T) {
+		clearAwsEnv(t)
+		emptyConfig := fstest.MapFS{"/": {Mode: fs.ModeDir}}
+		_, err := loadS3Secrets(emptyConfig, "")
+		assert.ErrorContains(t, err, "unable to find s3 secrets")
+	})
+
+	t.Run("should return the default secrets of secrets.json", func(t *testing.T) {
+		clearAwsEnv(t)
+		fakeFS := fstest.MapFS{"secrets.json": {Data: []byte(secrets)}, "config.yaml": {Data: []byte(clusterConfig)}}
+		config, err := loadS3Secrets(fakeFS, "")
+		assert.NoError(t, err)
+		assert.Equal(t, s3SecretsJSON{Id: "some-id", Key: "some-key", Region: "some-region"}, config)
+	})
+
+	t.Run("should return the requested profile", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-id")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-key")
 		fakeFS := fstest.MapFS{"secrets.json": {Data: []byte(secrets)}}
+		config, err := loadS3Secrets(fakeFS, "external")
+		assert.NoError(t, err)
+		assert.Equal(t, s3SecretsJSON{Id: "ext-id", Key: "ext-key", Region: "eu-west-1", Endpoint: "https://s3.example.com"}, config)
 
-		config, err := readS3Secrets(fakeFS)
+		_, err = loadS3Secrets(fakeFS, "missing")
+		assert.EqualError(t, err, `S3 profile "missing" not found. Did you set it with nuv s3 --profile missing secrets?`)
+	})
+
+	t.Run("should prefer the AWS env vars to the default secrets", func(t *testing.T) {
+		clearAwsEnv(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-id")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-key")
+		t.Setenv("AWS_SESSION_TOKEN", "env-token")
+		t.Setenv("AWS_ENDPOINT_URL", "http://localhost:9000")
+		fakeFS := fstest.MapFS{"secrets.json": {Data: []byte(secrets)}}
+		config, err := loadS3Secrets(fakeFS, "")
 		assert.NoError(t, err)
-		assert.Equal(t, expected, config)
+		assert.Equal(t, s3SecretsJSON{Id: "env-id", Key: "env-key", Token: "env-token", Region: defaultS3Region, Endpoint: "http://localhost:9000"}, config)
+	})
+
+	t.Run("should fall back to the credentials of the cluster config", func(t *testing.T) {
+		clearAwsEnv(t)
+		fakeFS := fstest.MapFS{"config.yaml": {Data: []byte(clusterConfig)}}
+		config, err := loadS3Secrets(fakeFS, "")
+		assert.NoError(t, err)
+		assert.Equal(t, s3SecretsJSON{Id: "cluster-id", Key: "cluster-key", Region: "eu-central-1", fromCluster: true}, config)
+	})
+
+	t.Run("should return error when secrets.json is not valid", func(t *testing.T) {
+		fakeFS := fstest.MapFS{"secrets.json": {Data: []byte("{")}}
+		_, err := loadS3Secrets(fakeFS, "")
+		assert.ErrorContains(t, err, "secrets.json is not valid")
 	})
 }
 
@@ -77,12 +125,100 @@ func Test_buildAwsConfig(t *testing.T) {
 			secrets.Key,
 			"",
 		),
+		S3ForcePathStyle: aws.Bool(true),
 	}
 
 	config := buildAwsConfig(secrets)
 	assert.Equal(t, expected, config)
 }
 
+func Test_clusterS3EndpointWithoutContext(t *testing.T) {
+	dir := t.TempDir()
+	restore := GetHomeDir
+	GetHomeDir = func() (string, error) { return dir, nil }
+	defer func() { GetHomeDir = restore }()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".kube"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".kube", "config"), []byte("apiVersion: v1\nkind: Config\n"), 0600))
+
+	_, err := clusterS3Endpoint()
+	assert.EqualError(t, err, "no current kubernetes context")
+}
+
+func Test_s3Endpoint(t *testing.T) {
+	requests := []string{}
+	standIn := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+	defer standIn.Close()
+
+	restore := clusterS3Endpoint
+	t.Cleanup(func() { clusterS3Endpoint = restore })
+	clusterS3Endpoint = func() (string, error) { return "", errors.New("no cluster") }
+	secrets := s3SecretsJSON{Id: "some-id", Key: "some-key", Region: "us-east-1"}
+
+	t.Run("should fall back to the default endpoint of the SDK", func(t *testing.T) {
+		clusterS3Endpoint = func() (string, error) { return "http://cluster", nil }
+		resolved, err := resolveS3Endpoint(secrets, s3Options{})
+		assert.NoError(t, err)
+		assert.Empty(t, resolved.Endpoint)
+		sess, err := session.NewSession(buildAwsConfig(resolved))
+		assert.NoError(t, err)
+		assert.Equal(t, "https://s3.amazonaws.com", s3.New(sess).Endpoint)
+	})
+
+	t.Run("should send the cluster credentials only to the cluster", func(t *testing.T) {
+		cluster := secrets
+		cluster.fromCluster = true
+		clusterS3Endpoint = func() (string, error) { return "http://cluster", nil }
+		resolved, err := resolveS3Endpoint(cluster, s3Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, "http://cluster", resolved.Endpoint)
+
+		clusterS3Endpoint = func() (string, error) { return "", errors.New("no cluster") }
+		_, err = resolveS3Endpoint(cluster, s3Options{})
+		assert.ErrorContains(t, err, "please specify the --endpoint: no cluster")
+	})
+
+	t.Run("should prefer the flag to the saved secrets", func(t *testing.T) {
+		saved := secrets
+		saved.Endpoint = "http://saved"
+		resolved, err := resolveS3Endpoint(saved, s3Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, "http://saved", resolved.Endpoint)
+		resolved, err = resolveS3Endpoint(saved, s3Options{Endpoint: "http://flag", Insecure: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "http://flag", resolved.Endpoint)
+		assert.True(t, resolved.Insecure)
+	})
+
+	t.Run("should use path-style addressing on the stand-in, skipping TLS verification", func(t *testing.T) {
+		resolved, err := resolveS3Endpoint(secrets, s3Options{Endpoint: standIn.URL, Insecure: true})
+		assert.NoError(t, err)
+		sess, err := session.NewSession(buildAwsConfig(resolved))
+		assert.NoError(t, err)
+		svc := s3.New(sess)
+		assert.NoError(t, createBucket(svc, "some-bucket"))
+		assert.Equal(t, []string{"PUT /some-bucket"}, requests)
+
+		resolved.Insecure = false
+		sess, _ = session.NewSession(buildAwsConfig(resolved))
+		assert.Error(t, createBucket(s3.New(sess), "some-bucket"))
+	})
+}
+
+func Test_readS3EndpointAnnotation(t *testing.T) {
+	cm := configmap.DeepCopy()
+	cm.Annotations[s3EndpointAnnotation] = "http://s3.nuvolaris.svc:9000"
+	testclient.clientset = fakeclient.NewSimpleClientset(nspace, cm)
+	endpoint, err := readS3EndpointAnnotation(&testclient)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://s3.nuvolaris.svc:9000", endpoint)
+
+	testclient.clientset = fakeclient.NewSimpleClientset(nspace, configmap)
+	_, err = readS3EndpointAnnotation(&testclient)
+	assert.ErrorContains(t, err, s3EndpointAnnotation)
+}
+
 type mockS3Client struct {
 	s3iface.S3API
 	mock.Mock
@@ -102,6 +238,181 @@ func (m *mockS3Client) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, er
 	return args.Get(0).(*s3.PutObjectOutput), args.Error(1)
 }
 
+func (m *mockS3Client) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.HeadObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteObject(in *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteObjects(in *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteObjectsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucket(in *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteBucketOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CopyObject(in *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.CopyObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) ListBuckets(in *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.ListBucketsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CreateMultipartUploadWithContext(_ aws.Context, in *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.CreateMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPartWithContext(_ aws.Context, in *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.UploadPartOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CompleteMultipartUploadWithContext(_ aws.Context, in *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.CompleteMultipartUploadOutput), args.Error(1)
+}
+
+// requestClient builds real requests, that can be presigned, without sending them
+func requestClient() *s3.S3 {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String("http://localhost"),
+		Credentials:      credentials.NewStaticCredentials("some-id", "some-key", ""),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+	return s3.New(sess)
+}
+
+func (m *mockS3Client) GetObjectRequest(in *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return requestClient().GetObjectRequest(in)
+}
+
+func (m *mockS3Client) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	return requestClient().PutObjectRequest(in)
+}
+
+func (m *mockS3Client) UploadPart(in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.UploadPartOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(in *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.CompleteMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) AbortMultipartUpload(in *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.AbortMultipartUploadOutput), args.Error(1)
+}
+
+// ListMultipartUploadsPages calls fn with the pages returned by the mock
+func (m *mockS3Client) ListMultipartUploadsPages(in *s3.ListMultipartUploadsInput, fn func(*s3.ListMultipartUploadsOutput, bool) bool) error {
+	args := m.Called(in)
+	pages := args.Get(0).([]*s3.ListMultipartUploadsOutput)
+	for i, page := range pages {
+		if !fn(page, i == len(pages)-1) {
+			break
+		}
+	}
+	return args.Error(1)
+}
+
+// ListPartsPages calls fn with the single page returned by the mock
+func (m *mockS3Client) ListPartsPages(in *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error {
+	args := m.Called(in)
+	fn(args.Get(0).(*s3.ListPartsOutput), true)
+	return args.Error(1)
+}
+
+// ListObjectsV2Pages calls fn with the pages returned by the mock
+func (m *mockS3Client) ListObjectsV2Pages(in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	args := m.Called(in)
+	pages := args.Get(0).([]*s3.ListObjectsV2Output)
+	for i, page := range pages {
+		if !fn(page, i == len(pages)-1) {
+			break
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketCors(in *s3.GetBucketCorsInput) (*s3.GetBucketCorsOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.GetBucketCorsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketCors(in *s3.PutBucketCorsInput) (*s3.PutBucketCorsOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.PutBucketCorsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucketCors(in *s3.DeleteBucketCorsInput) (*s3.DeleteBucketCorsOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteBucketCorsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketPolicy(in *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.GetBucketPolicyOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketPolicy(in *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.PutBucketPolicyOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucketPolicy(in *s3.DeleteBucketPolicyInput) (*s3.DeleteBucketPolicyOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteBucketPolicyOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketLifecycleConfiguration(in *s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.GetBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketLifecycleConfiguration(in *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.PutBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucketLifecycle(in *s3.DeleteBucketLifecycleInput) (*s3.DeleteBucketLifecycleOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteBucketLifecycleOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetBucketWebsite(in *s3.GetBucketWebsiteInput) (*s3.GetBucketWebsiteOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.GetBucketWebsiteOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutBucketWebsite(in *s3.PutBucketWebsiteInput) (*s3.PutBucketWebsiteOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.PutBucketWebsiteOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteBucketWebsite(in *s3.DeleteBucketWebsiteInput) (*s3.DeleteBucketWebsiteOutput, error) {
+	args := m.Called(in)
+	return args.Get(0).(*s3.DeleteBucketWebsiteOutput), args.Error(1)
+}
+
 func Test_createBucket(t *testing.T) {
 	t.Run("should use CreateBucket and return an error if unable to create bucket", func(t *testing.T) {
 		mockSvc := new(mockS3Client)
@@ -122,49 +433,21 @@ func Test_createBucket(t *testing.T) {
 	})
 }
 
-func Test_listBucketContent(t *testing.T) {
-	t.Run("should use ListObjectsV2 and return an error if error occurred", func(t *testing.T) {
-		mockSvc := new(mockS3Client)
-		mockSvc.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{}, errors.New("failed"))
-		bucketName := "some-bucket"
-		err := listBucketContent(mockSvc, bucketName)
-		mockSvc.AssertCalled(t, "ListObjectsV2", &s3.ListObjectsV2Input{Bucket: aws.String(bucketName)})
-		assert.Error(t, err)
-	})
-}
-
-func Test_putFile(t *testing.T) {
-	t.Run("should use PutObjet and return an error if error occurred", func(t *testing.T) {
-		mockSvc := new(mockS3Client)
-		mockSvc.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, errors.New("failed"))
-		bucketName := "some-bucket"
-		file := "some-file"
-		err := preparePut(file, "hello")(mockSvc, bucketName)
-		in := &s3.PutObjectInput{
-			Body:   strings.NewReader("hello"),
-			Key:    aws.String(file),
-			Bucket: aws.String(bucketName),
-			ACL:    aws.String(s3.BucketCannedACLPublicRead),
-		}
-		mockSvc.AssertCalled(t, "PutObject", in)
-		assert.Error(t, err)
-	})
-}
-
 func Test_saveSecrets(t *testing.T) {
-	id := "some-id"
-	key := "some-key"
-	region := "some-region"
-	s := secrets{Id: id, Key: key, Region: region}
-	err := s.Run()
-	assert.NoError(t, err)
+	home := t.TempDir()
+	defaultHome := GetHomeDir
+	GetHomeDir = func() (string, error) { return home, nil }
+	defer func() { GetHomeDir = defaultHome }()
 
-	path, _ := GetOrCreateNuvolarisConfigDir()
-	path = filepath.Join(path, secretFile)
-	content, err := os.ReadFile(path)
-	assert.NoError(t, err)
+	s := secrets{Id: "some-id", Key: "some-key", Region: "some-region"}
+	assert.NoError(t, s.Run(s3Options{}))
+	s = secrets{Id: "ext-id", Key: "ext-key", Region: "eu-west-1"}
+	assert.NoError(t, s.Run(s3Options{Profile: "external", Endpoint: "https://s3.example.com"}))
 
-	var sj s3SecretsJSON
-	json.Unmarshal(content, &sj)
-	assert.Equal(t, s3SecretsJSON{Id: id, Key: key, Region: region}, sj)
+	file, err := readS3SecretsFile(os.DirFS(filepath.Join(home, ".nuvolaris")))
+	assert.NoError(t, err)
+	assert.Equal(t, s3SecretsJSON{Id: "some-id", Key: "some-key", Region: "some-region"}, file.s3SecretsJSON)
+	assert.Equal(t, map[string]s3SecretsJSON{
+		"external": {Id: "ext-id", Key: "ext-key", Region: "eu-west-1", Endpoint: "https://s3.example.com"},
+	}, file.Profiles)
 }
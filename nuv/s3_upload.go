@@ -0,0 +1,290 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/alecthomas/units"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// uploadConfig tunes the multipart uploads
+type uploadConfig struct {
+	partSize    int64
+	concurrency int
+	object      objectFlags
+}
+
+func parseUploadConfig(partSize string, concurrency int) (uploadConfig, error) {
+	size, err := units.ParseStrictBytes(partSize)
+	if err != nil {
+		return uploadConfig{}, fmt.Errorf("invalid --part-size: %w", err)
+	}
+	if size < s3manager.MinUploadPartSize {
+		return uploadConfig{}, fmt.Errorf("--part-size must be at least 5MiB")
+	}
+	if concurrency < 1 {
+		return uploadConfig{}, fmt.Errorf("--concurrency must be at least 1")
+	}
+	return uploadConfig{partSize: size, concurrency: concurrency}, nil
+}
+
+type uploads struct {
+	BucketName string `arg:"" type:"string" help:"the name of the bucket to use"`
+	Prefix     string `arg:"" optional:"" type:"string" help:"show only the uploads of keys with this prefix"`
+	Abort      bool   `help:"abort the incomplete uploads, removing their parts"`
+}
+
+func (c *uploads) Run(opts s3Options) error {
+	return runS3With(opts, prepareIncompleteUploads(c.Prefix, c.Abort), c.BucketName)
+}
+
+// prepareMultipartUpload streams the file with the multipart uploader, showing the
+// progress; the parts of a failed upload are kept to resume it later
+func prepareMultipartUpload(fileName, key string, cfg uploadConfig, resume bool, logger *Logger) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		ctype, err := sniffContentType(fileName, f)
+		if err != nil {
+			return err
+		}
+
+		status := fmt.Sprintf("Uploading %q to bucket %q", fileName, bucketName)
+		logger.StartSpinner(status)
+		progress := newUploadProgress(info.Size(), logger)
+
+		if resume {
+			uploadID, err := findIncompleteUpload(svc, bucketName, key)
+			if err != nil {
+				logger.EndSpinner(false)
+				return err
+			}
+			if uploadID != "" {
+				err = resumeUpload(svc, bucketName, key, uploadID, f, info.Size(), cfg, progress)
+				logger.EndSpinner(err == nil)
+				if err != nil {
+					return s3Error(err, bucketName, key)
+				}
+				return nil
+			}
+		}
+
+		uploader := s3manager.NewUploaderWithClient(&progressS3{S3API: svc, progress: progress.add}, func(u *s3manager.Uploader) {
+			u.PartSize = cfg.partSize
+			u.Concurrency = cfg.concurrency
+			u.LeavePartsOnError = true
+		})
+		in := &s3manager.UploadInput{
+			Bucket:      aws.String(bucketName),
+			Key:         aws.String(key),
+			Body:        f,
+			ContentType: aws.String(ctype),
+		}
+		cfg.object.uploadInput(in)
+		_, err = uploader.Upload(in)
+		logger.EndSpinner(err == nil)
+		if err != nil {
+			if multi, ok := err.(s3manager.MultiUploadFailure); ok {
+				return fmt.Errorf("%w\nresume it with --resume or remove its parts with nuv s3 uploads %s %s --abort", s3Error(multi, bucketName, key), bucketName, key)
+			}
+			return s3Error(err, bucketName, key)
+		}
+		return nil
+	}
+}
+
+// uploadProgress shows the uploaded bytes in the spinner
+type uploadProgress struct {
+	total  int64
+	done   int64
+	logger *Logger
+}
+
+func newUploadProgress(total int64, logger *Logger) *uploadProgress {
+	return &uploadProgress{total: total, logger: logger}
+}
+
+func (p *uploadProgress) add(n int64) {
+	done := atomic.AddInt64(&p.done, n)
+	percent := int64(100)
+	if p.total > 0 {
+		percent = done * 100 / p.total
+	}
+	p.logger.SpinnerProgress(fmt.Sprintf("%d%% (%s of %s)", percent, humanSize(done), humanSize(p.total)))
+}
+
+// progressS3 reports the size of the parts successfully sent by the uploader
+type progressS3 struct {
+	s3iface.S3API
+	progress func(int64)
+}
+
+func (p *progressS3) UploadPartWithContext(ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	size, _ := aws.SeekerLen(in.Body)
+	out, err := p.S3API.UploadPartWithContext(ctx, in, opts...)
+	if err == nil {
+		p.progress(size)
+	}
+	return out, err
+}
+
+func (p *progressS3) PutObjectRequest(in *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	req, out := p.S3API.PutObjectRequest(in)
+	req.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			size, _ := aws.SeekerLen(in.Body)
+			p.progress(size)
+		}
+	})
+	return req, out
+}
+
+// findIncompleteUpload returns the id of the latest incomplete upload of the key
+func findIncompleteUpload(svc s3iface.S3API, bucketName, key string) (string, error) {
+	uploads, err := listIncompleteUploads(svc, bucketName, key)
+	if err != nil {
+		return "", err
+	}
+	id := ""
+	var latest int64
+	for _, u := range uploads {
+		if aws.StringValue(u.Key) != key {
+			continue
+		}
+		if t := aws.TimeValue(u.Initiated).UnixNano(); id == "" || t > latest {
+			id, latest = aws.StringValue(u.UploadId), t
+		}
+	}
+	return id, nil
+}
+
+// listIncompleteUploads returns the incomplete uploads under the prefix, from all the pages
+func listIncompleteUploads(svc s3iface.S3API, bucketName, prefix string) ([]*s3.MultipartUpload, error) {
+	uploads := []*s3.MultipartUpload{}
+	in := &s3.ListMultipartUploadsInput{Bucket: aws.String(bucketName), Prefix: aws.String(prefix)}
+	err := svc.ListMultipartUploadsPages(in, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		uploads = append(uploads, page.Uploads...)
+		return true
+	})
+	if err != nil {
+		return nil, s3Error(err, bucketName, prefix)
+	}
+	return uploads, nil
+}
+
+// resumeUpload sends only the parts missing or different from the ones already
+// uploaded, so the part size must be the same of the interrupted upload
+func resumeUpload(svc s3iface.S3API, bucketName, key, uploadID string, f *os.File, size int64, cfg uploadConfig, progress *uploadProgress) error {
+	uploaded := map[int64]*s3.Part{}
+	in := &s3.ListPartsInput{Bucket: aws.String(bucketName), Key: aws.String(key), UploadId: aws.String(uploadID)}
+	err := svc.ListPartsPages(in, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			uploaded[aws.Int64Value(part.PartNumber)] = part
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	parts := []*s3.CompletedPart{}
+	for number, offset := int64(1), int64(0); offset < size || number == 1; number, offset = number+1, offset+cfg.partSize {
+		length := cfg.partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		section := io.NewSectionReader(f, offset, length)
+		hash := md5.New()
+		if _, err := io.Copy(hash, section); err != nil {
+			return err
+		}
+		etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+		if part, ok := uploaded[number]; !ok || aws.StringValue(part.ETag) != etag || aws.Int64Value(part.Size) != length {
+			out, err := svc.UploadPart(&s3.UploadPartInput{
+				Bucket:     aws.String(bucketName),
+				Key:        aws.String(key),
+				UploadId:   aws.String(uploadID),
+				PartNumber: aws.Int64(number),
+				Body:       io.NewSectionReader(f, offset, length),
+			})
+			if err != nil {
+				return err
+			}
+			etag = aws.StringValue(out.ETag)
+		}
+		progress.add(length)
+		parts = append(parts, &s3.CompletedPart{ETag: aws.String(etag), PartNumber: aws.Int64(number)})
+	}
+
+	_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+func prepareIncompleteUploads(prefix string, abort bool) func(s3iface.S3API, string) error {
+	return func(svc s3iface.S3API, bucketName string) error {
+		uploads, err := listIncompleteUploads(svc, bucketName, prefix)
+		if err != nil {
+			return err
+		}
+		sort.Slice(uploads, func(i, j int) bool {
+			return aws.StringValue(uploads[i].Key) < aws.StringValue(uploads[j].Key)
+		})
+		for _, u := range uploads {
+			line := fmt.Sprintf("%s  %s  %s", aws.TimeValue(u.Initiated).Format("2006-01-02 15:04:05"), aws.StringValue(u.Key), aws.StringValue(u.UploadId))
+			if !abort {
+				fmt.Println(line)
+				continue
+			}
+			_, err := svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucketName),
+				Key:      u.Key,
+				UploadId: u.UploadId,
+			})
+			if err != nil {
+				return s3Error(err, bucketName, aws.StringValue(u.Key))
+			}
+			fmt.Println("aborted", line)
+		}
+		return nil
+	}
+}
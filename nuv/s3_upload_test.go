@@ -0,0 +1,191 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+//
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/nuvolaris/nuvolaris-cli/nuv/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testPartSize = s3manager.MinUploadPartSize
+
+// writeParts creates a file of two full parts and a last byte
+func writeParts(t *testing.T) (string, []byte) {
+	content := append(bytes.Repeat([]byte("a"), int(2*testPartSize)), 'b')
+	file := filepath.Join(t.TempDir(), "artifact.bin")
+	assert.NoError(t, os.WriteFile(file, content, 0644))
+	return file, content
+}
+
+func Test_parseUploadConfig(t *testing.T) {
+	cfg, err := parseUploadConfig("8MiB", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, uploadConfig{partSize: 8 * 1024 * 1024, concurrency: 4}, cfg)
+	_, err = parseUploadConfig("1MB", 4)
+	assert.ErrorContains(t, err, "at least 5MiB")
+	_, err = parseUploadConfig("8MiB", 0)
+	assert.ErrorContains(t, err, "--concurrency")
+	_, err = parseUploadConfig("big", 4)
+	assert.ErrorContains(t, err, "--part-size")
+}
+
+// run with -race: the parts report their progress while the status changes
+func Test_uploadProgressIsConcurrent(t *testing.T) {
+	logger := NewLogger()
+	logger.setWriter(log.NewSpinner(io.Discard))
+	logger.StartSpinner("Uploading")
+	progress := newUploadProgress(100, logger)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			progress.add(25)
+		}()
+	}
+	logger.EndSpinnerMsg(true, "Uploaded")
+	wg.Wait()
+	assert.Equal(t, int64(100), progress.done)
+}
+
+// Test_putFile sends a file smaller than a part, in a single private PutObject
+func Test_putFile(t *testing.T) {
+	requests := []*http.Request{}
+	bodies := []string{}
+	status := http.StatusOK
+	standIn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer standIn.Close()
+	sess, err := session.NewSession(buildAwsConfig(s3SecretsJSON{Id: "some-id", Key: "some-key", Region: "us-east-1", Endpoint: standIn.URL}))
+	assert.NoError(t, err)
+	svc := s3.New(sess)
+	file := filepath.Join(t.TempDir(), "some-file")
+	assert.NoError(t, os.WriteFile(file, []byte("hello"), 0644))
+	cfg := uploadConfig{partSize: testPartSize, concurrency: 1}
+
+	assert.NoError(t, prepareMultipartUpload(file, "some-file", cfg, false, NewLogger())(svc, "some-bucket"))
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "PUT /some-bucket/some-file", requests[0].Method+" "+requests[0].URL.Path)
+	assert.Equal(t, "private", requests[0].Header.Get("X-Amz-Acl"))
+	assert.Equal(t, "text/plain; charset=utf-8", requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "hello", bodies[0])
+
+	status = http.StatusForbidden
+	assert.Error(t, prepareMultipartUpload(file, "some-file", cfg, false, NewLogger())(svc, "some-bucket"))
+}
+
+func Test_prepareMultipartUpload(t *testing.T) {
+	file, _ := writeParts(t)
+	cfg := uploadConfig{partSize: testPartSize, concurrency: 2}
+
+	t.Run("should stream the parts and report the progress", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("CreateMultipartUploadWithContext", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil)
+		mockSvc.On("UploadPartWithContext", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String(`"etag"`)}, nil)
+		mockSvc.On("CompleteMultipartUploadWithContext", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+		assert.NoError(t, prepareMultipartUpload(file, "artifact.bin", cfg, false, NewLogger())(mockSvc, "some-bucket"))
+		mockSvc.AssertNumberOfCalls(t, "UploadPartWithContext", 3)
+		mockSvc.AssertCalled(t, "CreateMultipartUploadWithContext", mock.MatchedBy(func(in *s3.CreateMultipartUploadInput) bool {
+			return *in.ACL == "private" && *in.ContentType == "text/plain; charset=utf-8"
+		}))
+		mockSvc.AssertCalled(t, "CompleteMultipartUploadWithContext", mock.MatchedBy(func(in *s3.CompleteMultipartUploadInput) bool {
+			return *in.UploadId == "up-1" && len(in.MultipartUpload.Parts) == 3
+		}))
+	})
+
+	t.Run("should keep the parts of a failed upload and suggest to resume", func(t *testing.T) {
+		mockSvc := new(mockS3Client)
+		mockSvc.On("CreateMultipartUploadWithContext", mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("up-1")}, nil)
+		mockSvc.On("UploadPartWithContext", mock.Anything).Return(&s3.UploadPartOutput{}, assert.AnError)
+		err := prepareMultipartUpload(file, "artifact.bin", cfg, false, NewLogger())(mockSvc, "some-bucket")
+		assert.ErrorContains(t, err, "--resume")
+		mockSvc.AssertNotCalled(t, "AbortMultipartUploadWithContext", mock.Anything)
+	})
+}
+
+func Test_resumeUpload(t *testing.T) {
+	file, content := writeParts(t)
+	sum := md5.Sum(content[:testPartSize])
+	mockSvc := new(mockS3Client)
+	// the latest upload is on the second page
+	mockSvc.On("ListMultipartUploadsPages", mock.Anything).Return([]*s3.ListMultipartUploadsOutput{
+		{Uploads: []*s3.MultipartUpload{
+			{Key: aws.String("artifact.bin"), UploadId: aws.String("old"), Initiated: aws.Time(time.Unix(100, 0))},
+		}},
+		{Uploads: []*s3.MultipartUpload{
+			{Key: aws.String("artifact.bin"), UploadId: aws.String("latest"), Initiated: aws.Time(time.Unix(200, 0))},
+			{Key: aws.String("artifact.bin.sig"), UploadId: aws.String("other"), Initiated: aws.Time(time.Unix(300, 0))},
+		}},
+	}, nil)
+	// the first part was uploaded, the second one was truncated
+	mockSvc.On("ListPartsPages", mock.Anything).Return(&s3.ListPartsOutput{Parts: []*s3.Part{
+		{PartNumber: aws.Int64(1), ETag: aws.String(`"` + hex.EncodeToString(sum[:]) + `"`), Size: aws.Int64(testPartSize)},
+		{PartNumber: aws.Int64(2), ETag: aws.String(`"truncated"`), Size: aws.Int64(10)},
+	}}, nil)
+	mockSvc.On("UploadPart", mock.Anything).Return(&s3.UploadPartOutput{ETag: aws.String(`"new"`)}, nil)
+	mockSvc.On("CompleteMultipartUpload", mock.Anything).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	cfg := uploadConfig{partSize: testPartSize, concurrency: 1}
+	assert.NoError(t, prepareMultipartUpload(file, "artifact.bin", cfg, true, NewLogger())(mockSvc, "some-bucket"))
+	mockSvc.AssertNumberOfCalls(t, "UploadPart", 2)
+	mockSvc.AssertCalled(t, "UploadPart", mock.MatchedBy(func(in *s3.UploadPartInput) bool {
+		return *in.UploadId == "latest" && *in.PartNumber == 3
+	}))
+	mockSvc.AssertCalled(t, "CompleteMultipartUpload", mock.MatchedBy(func(in *s3.CompleteMultipartUploadInput) bool {
+		parts := in.MultipartUpload.Parts
+		return len(parts) == 3 && *parts[0].ETag == `"`+hex.EncodeToString(sum[:])+`"` && *parts[1].ETag == `"new"`
+	}))
+}
+
+func Example_prepareIncompleteUploads() {
+	mockSvc := new(mockS3Client)
+	initiated := aws.Time(time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC))
+	mockSvc.On("ListMultipartUploadsPages", mock.Anything).Return([]*s3.ListMultipartUploadsOutput{
+		{Uploads: []*s3.MultipartUpload{{Key: aws.String("b.zip"), UploadId: aws.String("up-2"), Initiated: initiated}}},
+		{Uploads: []*s3.MultipartUpload{{Key: aws.String("a.zip"), UploadId: aws.String("up-1"), Initiated: initiated}}},
+	}, nil)
+	mockSvc.On("AbortMultipartUpload", mock.Anything).Return(&s3.AbortMultipartUploadOutput{}, nil)
+	prepareIncompleteUploads("", false)(mockSvc, "some-bucket")
+	prepareIncompleteUploads("", true)(mockSvc, "some-bucket")
+	// Output:
+	// 2022-05-01 10:00:00  a.zip  up-1
+	// 2022-05-01 10:00:00  b.zip  up-2
+	// aborted 2022-05-01 10:00:00  a.zip  up-1
+	// aborted 2022-05-01 10:00:00  b.zip  up-2
+}
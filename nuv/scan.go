@@ -23,6 +23,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -111,6 +112,7 @@ var extRuntimes = map[string]string{
 type ScanTree struct {
 	name     string
 	path     string
+	params   map[string]string
 	packages []*ScanTree
 
 	mfActions []*Action
@@ -244,7 +246,7 @@ func parseSubFolders(projectRoot *ScanTree) []string {
 		taskQueue := make(chan string, len(subf.sfActions)+(len(subf.mfActions)*2))
 
 		// First level commands: packages from folders
-		t := packageUpdate(subf.name)
+		t := packageUpdate(subf.name) + packageParams(subf.params)
 
 		// Second level commands: single file actions from subfolders
 		wg.Add(1)
@@ -288,7 +290,7 @@ func parseMultiFileActions(taskQueue chan string, parent *ScanTree) {
 
 	wskPkg := parent.name + "/"
 	for _, mfAction := range parent.mfActions {
-		packCmd := fmt.Sprintf("nuv pack -r %s/%s.zip %s/*", mfAction.path, mfAction.name, mfAction.path)
+		packCmd := fmt.Sprintf("nuv pack %s/%s.zip %s", mfAction.path, mfAction.name, mfAction.path)
 		packPath := fmt.Sprintf("%s/%s.zip", mfAction.path, mfAction.name)
 		cmd := actionUpdate(wskPkg, mfAction.name, packPath, extRuntimes[mfAction.runtime])
 		taskQueue <- packCmd
@@ -303,6 +305,19 @@ func packageUpdate(pkgName string) string {
 	return fmt.Sprintf("nuv wsk package update %s", pkgName)
 }
 
+func packageParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := ""
+	for _, k := range keys {
+		res += fmt.Sprintf(" -p %s '%s'", k, strings.ReplaceAll(params[k], "'", `'\''`))
+	}
+	return res
+}
+
 // 4.
 func mergeIntoYaml(tasks []string) string {
 	taskfile := "version: 3\n\ntasks:\n  default:\n    cmds:"
@@ -47,7 +47,7 @@ func ExampleRun() {
 	//       - nuv wsk action update billing/form packages/billing/form.js --kind nodejs:default
 	//       - nuv wsk action update billing/send packages/billing/send.py --kind python:default
 	//       - nuv wsk package update mails
-	//       - nuv pack -r packages/mails/sendmail/sendmail.zip packages/mails/sendmail/*
+	//       - nuv pack packages/mails/sendmail/sendmail.zip packages/mails/sendmail
 	//       - nuv wsk action update mails/sendmail packages/mails/sendmail/sendmail.zip --kind nodejs:default
 }
 
@@ -67,7 +67,7 @@ func Example_generateTaskfile() {
 	//     cmds:
 	//       - nuv wsk action update hello packages/hello.js --kind nodejs:default
 	//       - nuv wsk package update subf1
-	//       - nuv pack -r packages/subf1/mfa/mfa.zip packages/subf1/mfa/*
+	//       - nuv pack packages/subf1/mfa/mfa.zip packages/subf1/mfa
 	//       - nuv wsk action update subf1/mfa packages/subf1/mfa/mfa.zip --kind nodejs:default
 }
 
@@ -310,7 +310,7 @@ func Test_parseProjectTree(t *testing.T) {
 		root.packages = []*ScanTree{{name: "subf"}}
 		root.packages[0].mfActions = []*Action{{name: "mf", path: "subf/mf", runtime: jsRuntime}}
 
-		packCmd := "nuv pack -r subf/mf/mf.zip subf/mf/*"
+		packCmd := "nuv pack subf/mf/mf.zip subf/mf"
 		mfaCmd := "nuv wsk action update subf/mf subf/mf/mf.zip --kind nodejs:default"
 
 		cmds := parseProjectTree(&root)
@@ -326,7 +326,7 @@ func Test_parseProjectTree(t *testing.T) {
 		root.packages[0].sfActions = []*Action{{name: "hello", path: "subf/hello.js", runtime: jsRuntime}}
 
 		sfaCmd := "nuv wsk action update subf/hello subf/hello.js --kind nodejs:default"
-		packCmd := "nuv pack -r subf/mf/mf.zip subf/mf/*"
+		packCmd := "nuv pack subf/mf/mf.zip subf/mf"
 		mfaCmd := "nuv wsk action update subf/mf subf/mf/mf.zip --kind python:default"
 
 		cmds := parseProjectTree(&root)
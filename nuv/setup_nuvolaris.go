@@ -57,6 +57,10 @@ func setupNuvolaris(logger *Logger, cmd *SetupCmd) error {
 		return nil
 	}
 
+	if cmd.Preload && !cmd.Devcluster {
+		return fmt.Errorf("--preload is only available with --devcluster")
+	}
+
 	if cmd.Configure {
 		err := checkApiHost(cmd)
 		if err != nil {
@@ -80,6 +84,10 @@ func setupNuvolaris(logger *Logger, cmd *SetupCmd) error {
 	if cmd.Devcluster {
 		sp.err = startDevCluster(sp.logger)
 		sp.k8sContext = "kind-nuvolaris"
+		if sp.err == nil && cmd.Preload {
+			images := append([]string{sp.operatorDockerImage}, cmd.Images...)
+			sp.err = preloadDevClusterImages(sp.logger, images, cmd.Pull)
+		}
 	} else if cmd.Context != "" {
 		err := checkApiHost(cmd)
 		if err != nil {
@@ -113,7 +113,6 @@ func flattenWskPropsMap(annotations map[string]string) []wskPropsKeyValue {
 func setWskPropsAsEnvVariable() error {
 	propMap, err := readWskPropsAsMap()
 	if err != nil {
-		fmt.Errorf(err.Error())
 		return err
 	}
 